@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -8,7 +10,10 @@ import (
 	"strings"
 )
 
-const inputFile = "input.txt"
+const (
+	inputFile = "input.txt"
+	groupSize = 3
+)
 
 func getPriority(char rune) int {
 	if char >= 'a' && char <= 'z' {
@@ -21,11 +26,272 @@ func getPriority(char rune) int {
 	return 0
 }
 
+func isItemType(char rune) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z'
+}
+
+// findSharedItems returns every distinct item found in all of the given
+// sacks, in the order they first appear in the first sack.
+func findSharedItems(sacks ...string) []rune {
+	shared := []rune{}
+	if len(sacks) == 0 {
+		return shared
+	}
+
+	seen := make(map[rune]bool)
+	for _, c := range sacks[0] {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+
+		inAll := true
+		for _, sack := range sacks[1:] {
+			if !strings.ContainsRune(sack, c) {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			shared = append(shared, c)
+		}
+	}
+
+	return shared
+}
+
+func checkItems(shared []rune, kind string) []string {
+	anomalies := []string{}
+
+	switch {
+	case len(shared) == 0:
+		anomalies = append(anomalies, "no shared "+kind)
+	case len(shared) > 1:
+		anomalies = append(
+			anomalies,
+			fmt.Sprintf("multiple shared %ss: %q", kind, string(shared)),
+		)
+	}
+
+	for _, c := range shared {
+		if !isItemType(c) {
+			anomalies = append(
+				anomalies,
+				fmt.Sprintf("%s %q is not a valid item type (priority 0)", kind, c),
+			)
+		}
+	}
+
+	return anomalies
+}
+
+type rucksackReport struct {
+	Line         int      `json:"line"`
+	Contents     string   `json:"contents"`
+	Compartment1 string   `json:"compartment1"`
+	Compartment2 string   `json:"compartment2"`
+	Item         string   `json:"item"`
+	Priority     int      `json:"priority"`
+	Anomalies    []string `json:"anomalies,omitempty"`
+}
+
+func auditRucksack(line int, contents string) rucksackReport {
+	report := rucksackReport{
+		Line:         line,
+		Contents:     contents,
+		Compartment1: contents[:len(contents)/2],
+		Compartment2: contents[len(contents)/2:],
+	}
+
+	if len(contents)%2 != 0 {
+		report.Anomalies = append(
+			report.Anomalies,
+			fmt.Sprintf(
+				"odd length %d splits unevenly into %d and %d items",
+				len(contents),
+				len(report.Compartment1),
+				len(report.Compartment2),
+			),
+		)
+	}
+
+	for _, c := range contents {
+		if !isItemType(c) {
+			report.Anomalies = append(
+				report.Anomalies,
+				fmt.Sprintf("invalid item type %q", c),
+			)
+		}
+	}
+
+	shared := findSharedItems(report.Compartment1, report.Compartment2)
+	if len(shared) > 0 {
+		report.Item = string(shared[0])
+		report.Priority = getPriority(shared[0])
+	}
+	report.Anomalies = append(report.Anomalies, checkItems(shared, "item")...)
+
+	return report
+}
+
+type groupReport struct {
+	Group     int      `json:"group"`
+	Lines     []int    `json:"lines"`
+	Badge     string   `json:"badge"`
+	Priority  int      `json:"priority"`
+	Anomalies []string `json:"anomalies,omitempty"`
+}
+
+func auditGroup(group int, lines []int, sacks []string) groupReport {
+	report := groupReport{
+		Group: group,
+		Lines: lines,
+	}
+
+	if len(sacks) != groupSize {
+		report.Anomalies = append(
+			report.Anomalies,
+			fmt.Sprintf(
+				"incomplete group of %d rucksacks, expected %d",
+				len(sacks),
+				groupSize,
+			),
+		)
+	}
+
+	shared := findSharedItems(sacks...)
+	if len(shared) > 0 {
+		report.Badge = string(shared[0])
+		report.Priority = getPriority(shared[0])
+	}
+	report.Anomalies = append(report.Anomalies, checkItems(shared, "badge")...)
+
+	return report
+}
+
+type auditReport struct {
+	Rucksacks    []rucksackReport `json:"rucksacks"`
+	Groups       []groupReport    `json:"groups"`
+	ItemsSum     int              `json:"itemsSum"`
+	BadgesSum    int              `json:"badgesSum"`
+	AnomalyCount int              `json:"anomalyCount"`
+}
+
+func auditRucksacks(input string) auditReport {
+	report := auditReport{
+		Rucksacks: []rucksackReport{},
+		Groups:    []groupReport{},
+	}
+
+	rucksacks := strings.Split(input, "\n")
+	for i, r := range rucksacks {
+		sack := auditRucksack(i+1, r)
+		report.ItemsSum += sack.Priority
+		report.AnomalyCount += len(sack.Anomalies)
+		report.Rucksacks = append(report.Rucksacks, sack)
+	}
+
+	for i := 0; i < len(rucksacks); i += groupSize {
+		end := i + groupSize
+		if end > len(rucksacks) {
+			end = len(rucksacks)
+		}
+
+		lines := []int{}
+		for l := i; l < end; l++ {
+			lines = append(lines, l+1)
+		}
+
+		group := auditGroup(i/groupSize+1, lines, rucksacks[i:end])
+		report.BadgesSum += group.Priority
+		report.AnomalyCount += len(group.Anomalies)
+		report.Groups = append(report.Groups, group)
+	}
+
+	return report
+}
+
+func (r auditReport) writeText(w io.Writer) {
+	fmt.Fprintln(w, "Rucksacks:")
+	for _, sack := range r.Rucksacks {
+		fmt.Fprintf(
+			w,
+			"  %4d: %s | %s -> item %q, priority %d\n",
+			sack.Line,
+			sack.Compartment1,
+			sack.Compartment2,
+			sack.Item,
+			sack.Priority,
+		)
+		for _, a := range sack.Anomalies {
+			fmt.Fprintln(w, "        !", a)
+		}
+	}
+
+	fmt.Fprintln(w, "Groups:")
+	for _, group := range r.Groups {
+		fmt.Fprintf(
+			w,
+			"  %4d: lines %v -> badge %q, priority %d\n",
+			group.Group,
+			group.Lines,
+			group.Badge,
+			group.Priority,
+		)
+		for _, a := range group.Anomalies {
+			fmt.Fprintln(w, "        !", a)
+		}
+	}
+
+	fmt.Fprintln(w, "Sum of item priorities:", r.ItemsSum)
+	fmt.Fprintln(w, "Sum of badge priorities:", r.BadgesSum)
+	fmt.Fprintln(w, "Anomalies found:", r.AnomalyCount)
+}
+
+func (r auditReport) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
 func main() {
+	audit := flag.Bool("audit", false, "list every rucksack, group and anomaly")
+	format := flag.String("format", "text", "audit output format: text or json")
+	flag.Parse()
+
+	if *audit {
+		runAudit(*format)
+		return
+	}
+
 	part1()
 	part2()
 }
 
+func runAudit(format string) {
+	bytes, err := os.ReadFile(inputFile)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	input := strings.TrimSpace(string(bytes))
+	report := auditRucksacks(input)
+
+	switch format {
+	case "text":
+		report.writeText(os.Stdout)
+	case "json":
+		if err := report.writeJSON(os.Stdout); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+	default:
+		log.Println("unknown audit format:", format)
+		os.Exit(1)
+	}
+}
+
 func part1() {
 	prioritiesSum := 0
 
@@ -1,27 +1,385 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"sort"
 	"strings"
 )
 
+// interval is a closed range of section IDs, inclusive of both ends.
+type interval struct {
+	start, end int
+}
+
+func (i interval) String() string {
+	return fmt.Sprintf("%d-%d", i.start, i.end)
+}
+
+func (i interval) Len() int {
+	if i.end < i.start {
+		return 0
+	}
+	return i.end - i.start + 1
+}
+
+func (i interval) contains(o interval) bool {
+	return o.start >= i.start && o.end <= i.end
+}
+
+func (i interval) overlaps(o interval) bool {
+	return i.end >= o.start && i.start <= o.end
+}
+
+// touches reports whether the intervals overlap or sit directly next to each
+// other, i.e. whether their union is a single interval.
+func (i interval) touches(o interval) bool {
+	return i.end+1 >= o.start && i.start <= o.end+1
+}
+
+func (i interval) intersect(o interval) (interval, bool) {
+	if !i.overlaps(o) {
+		return interval{}, false
+	}
+
+	return interval{start: max(i.start, o.start), end: min(i.end, o.end)}, true
+}
+
+func (i interval) union(o interval) []interval {
+	if !i.touches(o) {
+		if o.start < i.start {
+			return []interval{o, i}
+		}
+		return []interval{i, o}
+	}
+
+	return []interval{{start: min(i.start, o.start), end: max(i.end, o.end)}}
+}
+
+func (i interval) difference(o interval) []interval {
+	if !i.overlaps(o) {
+		return []interval{i}
+	}
+
+	diff := []interval{}
+	if i.start < o.start {
+		diff = append(diff, interval{start: i.start, end: o.start - 1})
+	}
+	if i.end > o.end {
+		diff = append(diff, interval{start: o.end + 1, end: i.end})
+	}
+
+	return diff
+}
+
+// mergeIntervals returns the smallest sorted set of disjoint intervals
+// covering the same sections as the given intervals.
+func mergeIntervals(intervals []interval) []interval {
+	sorted := make([]interval, len(intervals))
+	copy(sorted, intervals)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].start < sorted[b].start
+	})
+
+	merged := []interval{}
+	for _, i := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && merged[last].touches(i) {
+			merged[last].end = max(merged[last].end, i.end)
+			continue
+		}
+		merged = append(merged, i)
+	}
+
+	return merged
+}
+
+func totalLen(intervals []interval) int {
+	total := 0
+	for _, i := range intervals {
+		total += i.Len()
+	}
+	return total
+}
+
 type elfPair struct {
-	range1 [2]int
-	range2 [2]int
+	range1 interval
+	range2 interval
 }
 
 func (p elfPair) isContained() bool {
-	return p.range1[0] >= p.range2[0] && p.range1[1] <= p.range2[1] ||
-		p.range2[0] >= p.range1[0] && p.range2[1] <= p.range1[1]
+	return p.range2.contains(p.range1) || p.range1.contains(p.range2)
 }
 
 func (p elfPair) isOverlapped() bool {
-	return p.range1[1] >= p.range2[0] && p.range1[0] <= p.range2[1]
+	return p.range1.overlaps(p.range2)
+}
+
+type sectionCoverage struct {
+	uncovered []interval
+	single    []interval
+	crowded   []interval
+}
+
+// getSectionCoverage sweeps over every elf's assignment and groups the
+// sections between the lowest and highest assigned section by how many elves
+// cover them.
+func getSectionCoverage(pairs []elfPair) sectionCoverage {
+	var coverage sectionCoverage
+	if len(pairs) == 0 {
+		return coverage
+	}
+
+	deltas := make(map[int]int)
+	for _, pair := range pairs {
+		for _, r := range []interval{pair.range1, pair.range2} {
+			deltas[r.start]++
+			deltas[r.end+1]--
+		}
+	}
+
+	points := make([]int, 0, len(deltas))
+	for p := range deltas {
+		points = append(points, p)
+	}
+	sort.Ints(points)
+
+	covering := 0
+	for i := 0; i < len(points)-1; i++ {
+		covering += deltas[points[i]]
+		segment := interval{start: points[i], end: points[i+1] - 1}
+
+		switch {
+		case covering == 0:
+			coverage.uncovered = append(coverage.uncovered, segment)
+		case covering == 1:
+			coverage.single = append(coverage.single, segment)
+		case covering > 2:
+			coverage.crowded = append(coverage.crowded, segment)
+		}
+	}
+
+	coverage.uncovered = mergeIntervals(coverage.uncovered)
+	coverage.single = mergeIntervals(coverage.single)
+	coverage.crowded = mergeIntervals(coverage.crowded)
+
+	return coverage
+}
+
+// assignment is a single elf's section assignment, identified by the line of
+// the input it came from and its position within that line's pair.
+type assignment struct {
+	pair, elf int
+	sections  interval
+}
+
+func (a assignment) String() string {
+	return fmt.Sprintf("%d.%d(%v)", a.pair, a.elf, a.sections)
+}
+
+func getAssignments(pairs []elfPair) []assignment {
+	assignments := make([]assignment, 0, len(pairs)*2)
+	for i, pair := range pairs {
+		assignments = append(
+			assignments,
+			assignment{pair: i + 1, elf: 1, sections: pair.range1},
+			assignment{pair: i + 1, elf: 2, sections: pair.range2},
+		)
+	}
+	return assignments
+}
+
+// assignmentIndex is a static interval tree over a set of assignments. The
+// assignments are sorted by start (and by descending end for equal starts)
+// and the sorted slice is treated as an implicit balanced binary tree, where
+// the node for the range [lo, hi) sits at its midpoint. maxEnd holds the
+// largest end in each node's subtree, which lets queries skip whole subtrees.
+type assignmentIndex struct {
+	assignments []assignment
+	maxEnd      []int
+}
+
+func newAssignmentIndex(assignments []assignment) *assignmentIndex {
+	sorted := make([]assignment, len(assignments))
+	copy(sorted, assignments)
+	sort.Slice(sorted, func(a, b int) bool {
+		sa, sb := sorted[a].sections, sorted[b].sections
+		if sa.start != sb.start {
+			return sa.start < sb.start
+		}
+		return sa.end > sb.end
+	})
+
+	idx := &assignmentIndex{
+		assignments: sorted,
+		maxEnd:      make([]int, len(sorted)),
+	}
+	idx.build(0, len(sorted))
+
+	return idx
+}
+
+func (idx *assignmentIndex) build(lo, hi int) int {
+	if lo >= hi {
+		return math.MinInt
+	}
+
+	mid := (lo + hi) / 2
+	maxEnd := idx.assignments[mid].sections.end
+	maxEnd = max(maxEnd, idx.build(lo, mid))
+	maxEnd = max(maxEnd, idx.build(mid+1, hi))
+	idx.maxEnd[mid] = maxEnd
+
+	return maxEnd
+}
+
+// visit calls fn for every assignment in the first limit sorted positions
+// whose start is at most maxStart and whose end is at least minEnd.
+func (idx *assignmentIndex) visit(
+	lo, hi, limit, maxStart, minEnd int,
+	fn func(assignment),
+) {
+	if lo >= hi || lo >= limit {
+		return
+	}
+
+	mid := (lo + hi) / 2
+	if idx.maxEnd[mid] < minEnd {
+		return
+	}
+
+	idx.visit(lo, mid, limit, maxStart, minEnd, fn)
+
+	a := idx.assignments[mid]
+	if mid >= limit || a.sections.start > maxStart {
+		return
+	}
+	if a.sections.end >= minEnd {
+		fn(a)
+	}
+
+	idx.visit(mid+1, hi, limit, maxStart, minEnd, fn)
+}
+
+// overlapping returns every assignment sharing at least one section with
+// the given interval, in O(log n + k) time.
+func (idx *assignmentIndex) overlapping(query interval) []assignment {
+	found := []assignment{}
+	idx.visit(
+		0, len(idx.assignments), len(idx.assignments),
+		query.end, query.start,
+		func(a assignment) {
+			found = append(found, a)
+		},
+	)
+	return found
+}
+
+// forEachContainment calls fn once for every pair of assignments where outer
+// fully contains inner. Identical assignments are reported once, with the
+// one that sorts first as the outer assignment.
+func (idx *assignmentIndex) forEachContainment(
+	fn func(outer, inner assignment),
+) {
+	for p, inner := range idx.assignments {
+		idx.visit(
+			0, len(idx.assignments), p,
+			inner.sections.start, inner.sections.end,
+			func(outer assignment) {
+				fn(outer, inner)
+			},
+		)
+	}
+}
+
+func (idx *assignmentIndex) containments() [][2]assignment {
+	found := [][2]assignment{}
+	idx.forEachContainment(func(outer, inner assignment) {
+		found = append(found, [2]assignment{outer, inner})
+	})
+	return found
+}
+
+// maxOverlap returns the largest number of assignments covering a single
+// section, along with the first range of sections where that happens. It
+// sweeps over the sections where assignments start and stop, in O(n log n)
+// time.
+func (idx *assignmentIndex) maxOverlap() (int, interval) {
+	n := len(idx.assignments)
+	starts := make([]int, n)
+	stops := make([]int, n) // the first section after each assignment
+	for i, a := range idx.assignments {
+		starts[i] = a.sections.start
+		stops[i] = a.sections.end + 1
+	}
+	sort.Ints(stops)
+
+	best, bestRange := 0, interval{}
+	covering, s, e := 0, 0, 0
+	extending := false
+	for e < n {
+		pos := stops[e]
+		if s < n {
+			pos = min(pos, starts[s])
+		}
+		for e < n && stops[e] == pos {
+			covering--
+			e++
+		}
+		for s < n && starts[s] == pos {
+			covering++
+			s++
+		}
+
+		// covering now holds for every section up to the next boundary.
+		next := math.MaxInt
+		if e < n {
+			next = stops[e]
+		}
+		if s < n {
+			next = min(next, starts[s])
+		}
+
+		switch {
+		case covering > best:
+			best, bestRange = covering, interval{start: pos, end: next - 1}
+			extending = true
+		case extending && covering == best:
+			bestRange.end = next - 1
+		default:
+			extending = false
+		}
+	}
+
+	return best, bestRange
 }
 
 func main() {
+	showCoverage := flag.Bool(
+		"coverage",
+		false,
+		"report sections covered by nobody, one elf or more than two elves",
+	)
+	query := flag.String(
+		"overlapping",
+		"",
+		"list every assignment overlapping the sections `a-b`",
+	)
+	showContainments := flag.Bool(
+		"containments",
+		false,
+		"list every assignment containing another assignment",
+	)
+	showMaxOverlap := flag.Bool(
+		"max-overlap",
+		false,
+		"report the most assignments covering a single section",
+	)
+	flag.Parse()
+
 	bytes, err := os.ReadFile("input.txt")
 	if err != nil {
 		log.Println(err)
@@ -33,6 +391,31 @@ func main() {
 
 	part1(pairs)
 	part2(pairs)
+
+	if *showCoverage {
+		coverage(pairs)
+	}
+
+	if *query == "" && !*showContainments && !*showMaxOverlap {
+		return
+	}
+
+	idx := newAssignmentIndex(getAssignments(pairs))
+	if *query != "" {
+		var sections interval
+		_, err := fmt.Sscanf(*query, "%d-%d", &sections.start, &sections.end)
+		if err != nil {
+			log.Println("invalid section range:", *query)
+			os.Exit(1)
+		}
+		overlapping(idx, sections)
+	}
+	if *showContainments {
+		containments(idx)
+	}
+	if *showMaxOverlap {
+		maxOverlap(idx)
+	}
 }
 
 func getPairs(input string) []elfPair {
@@ -44,7 +427,8 @@ func getPairs(input string) []elfPair {
 		fmt.Sscanf(
 			line,
 			"%d-%d,%d-%d",
-			&pair.range1[0], &pair.range1[1], &pair.range2[0], &pair.range2[1],
+			&pair.range1.start, &pair.range1.end,
+			&pair.range2.start, &pair.range2.end,
 		)
 
 		pairs = append(pairs, pair)
@@ -82,3 +466,45 @@ func part2(pairs []elfPair) {
 		totalOverlapped,
 	)
 }
+
+func coverage(pairs []elfPair) {
+	cov := getSectionCoverage(pairs)
+
+	fmt.Printf(
+		"Sections covered by nobody (%d): %v\n",
+		totalLen(cov.uncovered),
+		cov.uncovered,
+	)
+	fmt.Printf(
+		"Sections covered by exactly one elf (%d): %v\n",
+		totalLen(cov.single),
+		cov.single,
+	)
+	fmt.Printf(
+		"Sections covered by more than two elves (%d): %v\n",
+		totalLen(cov.crowded),
+		cov.crowded,
+	)
+}
+
+func overlapping(idx *assignmentIndex, sections interval) {
+	found := idx.overlapping(sections)
+	fmt.Printf("Assignments overlapping %v (%d): %v\n", sections, len(found), found)
+}
+
+func containments(idx *assignmentIndex) {
+	found := idx.containments()
+	fmt.Println("Assignments containing another assignment:", len(found))
+	for _, c := range found {
+		fmt.Printf("  %v contains %v\n", c[0], c[1])
+	}
+}
+
+func maxOverlap(idx *assignmentIndex) {
+	count, sections := idx.maxOverlap()
+	fmt.Printf(
+		"The most assignments covering a single section is %d, at sections %v\n",
+		count,
+		sections,
+	)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func generateAssignments(n int, rng *rand.Rand) []assignment {
+	assignments := make([]assignment, n)
+	for i := range assignments {
+		start := 1 + rng.Intn(n*100)
+		assignments[i] = assignment{
+			pair:     i/2 + 1,
+			elf:      i%2 + 1,
+			sections: interval{start: start, end: start + rng.Intn(100)},
+		}
+	}
+	return assignments
+}
+
+func TestIntervalOperations(t *testing.T) {
+	tests := []struct {
+		name          string
+		i, o          interval
+		intersection  interval
+		intersects    bool
+		union, except []interval
+	}{
+		{
+			name:   "disjoint",
+			i:      interval{1, 3},
+			o:      interval{5, 7},
+			union:  []interval{{1, 3}, {5, 7}},
+			except: []interval{{1, 3}},
+		},
+		{
+			name:   "disjoint reversed",
+			i:      interval{5, 7},
+			o:      interval{1, 3},
+			union:  []interval{{1, 3}, {5, 7}},
+			except: []interval{{5, 7}},
+		},
+		{
+			name:   "adjacent",
+			i:      interval{1, 3},
+			o:      interval{4, 5},
+			union:  []interval{{1, 5}},
+			except: []interval{{1, 3}},
+		},
+		{
+			name:         "overlapping",
+			i:            interval{1, 5},
+			o:            interval{3, 8},
+			intersection: interval{3, 5},
+			intersects:   true,
+			union:        []interval{{1, 8}},
+			except:       []interval{{1, 2}},
+		},
+		{
+			name:         "nested inside",
+			i:            interval{1, 10},
+			o:            interval{3, 4},
+			intersection: interval{3, 4},
+			intersects:   true,
+			union:        []interval{{1, 10}},
+			except:       []interval{{1, 2}, {5, 10}},
+		},
+		{
+			name:         "nested around",
+			i:            interval{3, 4},
+			o:            interval{1, 10},
+			intersection: interval{3, 4},
+			intersects:   true,
+			union:        []interval{{1, 10}},
+			except:       []interval{},
+		},
+		{
+			name:         "identical",
+			i:            interval{2, 6},
+			o:            interval{2, 6},
+			intersection: interval{2, 6},
+			intersects:   true,
+			union:        []interval{{2, 6}},
+			except:       []interval{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.i.intersect(tt.o)
+			if ok != tt.intersects || got != tt.intersection {
+				t.Errorf(
+					"%v.intersect(%v) = %v, %v; want %v, %v",
+					tt.i, tt.o, got, ok, tt.intersection, tt.intersects,
+				)
+			}
+			if got := tt.i.union(tt.o); !reflect.DeepEqual(got, tt.union) {
+				t.Errorf("%v.union(%v) = %v; want %v", tt.i, tt.o, got, tt.union)
+			}
+			if got := tt.i.difference(tt.o); !reflect.DeepEqual(got, tt.except) {
+				t.Errorf(
+					"%v.difference(%v) = %v; want %v",
+					tt.i, tt.o, got, tt.except,
+				)
+			}
+		})
+	}
+}
+
+// smallAssignments generates assignments packed into a few sections, so
+// that most of them overlap or contain each other.
+func smallAssignments(n int, rng *rand.Rand) []assignment {
+	assignments := make([]assignment, n)
+	for i := range assignments {
+		start := 1 + rng.Intn(60)
+		assignments[i] = assignment{
+			pair:     i/2 + 1,
+			elf:      i%2 + 1,
+			sections: interval{start: start, end: start + rng.Intn(20)},
+		}
+	}
+	return assignments
+}
+
+func sortAssignments(assignments []assignment) {
+	sort.Slice(assignments, func(a, b int) bool {
+		return assignments[a].String() < assignments[b].String()
+	})
+}
+
+// pairKey identifies an unordered pair of assignments.
+func pairKey(a, b assignment) string {
+	x, y := a.String(), b.String()
+	if x > y {
+		x, y = y, x
+	}
+	return x + " " + y
+}
+
+func TestAssignmentIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for round := 0; round < 50; round++ {
+		assignments := smallAssignments(1+rng.Intn(200), rng)
+		idx := newAssignmentIndex(assignments)
+
+		for q := 0; q < 20; q++ {
+			start := rng.Intn(90)
+			query := interval{start: start, end: start + rng.Intn(10)}
+
+			want := []assignment{}
+			for _, a := range assignments {
+				if a.sections.overlaps(query) {
+					want = append(want, a)
+				}
+			}
+			got := idx.overlapping(query)
+
+			sortAssignments(want)
+			sortAssignments(got)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("overlapping(%v) = %v; want %v", query, got, want)
+			}
+		}
+
+		want := map[string]bool{}
+		for i, a := range assignments {
+			for _, b := range assignments[i+1:] {
+				if a.sections.contains(b.sections) || b.sections.contains(a.sections) {
+					want[pairKey(a, b)] = true
+				}
+			}
+		}
+		got := map[string]bool{}
+		idx.forEachContainment(func(outer, inner assignment) {
+			key := pairKey(outer, inner)
+			if got[key] {
+				t.Fatalf("containment %s reported twice", key)
+			}
+			if !outer.sections.contains(inner.sections) {
+				t.Fatalf("%v does not contain %v", outer, inner)
+			}
+			got[key] = true
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("found %d containments; want %d", len(got), len(want))
+		}
+
+		counts := make([]int, 100)
+		for _, a := range assignments {
+			for s := a.sections.start; s <= a.sections.end; s++ {
+				counts[s]++
+			}
+		}
+		best, bestRange := 0, interval{}
+		for s, count := range counts {
+			if count > best {
+				best, bestRange = count, interval{start: s, end: s}
+			} else if count == best && bestRange.end == s-1 && best > 0 {
+				bestRange.end = s
+			}
+		}
+
+		gotBest, gotRange := idx.maxOverlap()
+		if gotBest != best || gotRange != bestRange {
+			t.Fatalf(
+				"maxOverlap() = %d, %v; want %d, %v",
+				gotBest, gotRange, best, bestRange,
+			)
+		}
+	}
+}
+
+var (
+	// benchSizes go up to millions of assignments to show how the index
+	// scales, while the brute-force baselines are quadratic and only run on
+	// the smallest sizes.
+	benchSizes      = []int{10_000, 20_000, 40_000, 100_000, 1_000_000, 2_000_000}
+	bruteForceSizes = []int{10_000, 20_000, 40_000}
+
+	generated = map[int][]assignment{}
+)
+
+func benchAssignments(n int) []assignment {
+	if _, ok := generated[n]; !ok {
+		generated[n] = generateAssignments(n, rand.New(rand.NewSource(1)))
+	}
+	return generated[n]
+}
+
+// benchmarkSizes runs fn as a sub-benchmark for each number of assignments.
+func benchmarkSizes(
+	b *testing.B,
+	prefix string,
+	sizes []int,
+	fn func(b *testing.B, assignments []assignment),
+) {
+	for _, n := range sizes {
+		assignments := benchAssignments(n)
+		b.Run(fmt.Sprintf("%s/n=%d", prefix, n), func(b *testing.B) {
+			fn(b, assignments)
+		})
+	}
+}
+
+func BenchmarkIndexBuild(b *testing.B) {
+	benchmarkSizes(b, "index", benchSizes, func(b *testing.B, as []assignment) {
+		for i := 0; i < b.N; i++ {
+			newAssignmentIndex(as)
+		}
+	})
+}
+
+func BenchmarkOverlapping(b *testing.B) {
+	query := func(rng *rand.Rand, n int) interval {
+		start := 1 + rng.Intn(n*100)
+		return interval{start: start, end: start + 1000}
+	}
+
+	benchmarkSizes(b, "index", benchSizes, func(b *testing.B, as []assignment) {
+		idx := newAssignmentIndex(as)
+		rng := rand.New(rand.NewSource(1))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			idx.overlapping(query(rng, len(as)))
+		}
+	})
+	benchmarkSizes(b, "bruteForce", bruteForceSizes, func(b *testing.B, as []assignment) {
+		rng := rand.New(rand.NewSource(1))
+
+		for i := 0; i < b.N; i++ {
+			q := query(rng, len(as))
+			found := []assignment{}
+			for _, a := range as {
+				if a.sections.overlaps(q) {
+					found = append(found, a)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkContainments(b *testing.B) {
+	benchmarkSizes(b, "index", benchSizes, func(b *testing.B, as []assignment) {
+		idx := newAssignmentIndex(as)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			count := 0
+			idx.forEachContainment(func(_, _ assignment) {
+				count++
+			})
+		}
+	})
+	benchmarkSizes(b, "bruteForce", bruteForceSizes, func(b *testing.B, as []assignment) {
+		for i := 0; i < b.N; i++ {
+			count := 0
+			for p, a := range as {
+				for _, o := range as[p+1:] {
+					if a.sections.contains(o.sections) || o.sections.contains(a.sections) {
+						count++
+					}
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkMaxOverlap(b *testing.B) {
+	benchmarkSizes(b, "index", benchSizes, func(b *testing.B, as []assignment) {
+		idx := newAssignmentIndex(as)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			idx.maxOverlap()
+		}
+	})
+	benchmarkSizes(b, "bruteForce", bruteForceSizes, func(b *testing.B, as []assignment) {
+		for i := 0; i < b.N; i++ {
+			best := 0
+			for _, a := range as {
+				covering := 0
+				for _, o := range as {
+					if o.sections.start <= a.sections.start &&
+						o.sections.end >= a.sections.start {
+						covering++
+					}
+				}
+				best = max(best, covering)
+			}
+		}
+	})
+}
@@ -1,41 +1,204 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type craneInstruction struct {
 	source, dest, amount int
 }
 
-func parseCraneInstructions(input string) []craneInstruction {
+func (i craneInstruction) String() string {
+	return fmt.Sprintf("move %d from %d to %d", i.amount, i.source, i.dest)
+}
+
+func parseCraneInstructions(input string) ([]craneInstruction, error) {
 	lines := strings.Split(input, "\n")
 	instructions := make([]craneInstruction, 0, len(lines))
 
-	for _, line := range lines {
+	for i, line := range lines {
 		var instruction craneInstruction
-		fmt.Sscanf(
-			line,
+		_, err := fmt.Sscanf(
+			strings.TrimSpace(line),
 			"move %d from %d to %d",
 			&instruction.amount, &instruction.source, &instruction.dest,
 		)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: invalid instruction %q", i+1, line)
+		}
 
 		instructions = append(instructions, instruction)
 	}
 
-	return instructions
+	return instructions, nil
+}
+
+// CraneModel is a crane able to carry out rearrangement procedures. Models
+// are looked up by name, so new ones only need adding to craneModels.
+type CraneModel interface {
+	Name() string
+	Move(stack crateStack, inst craneInstruction)
+}
+
+type crateMover9000 struct{}
+
+func (crateMover9000) Name() string {
+	return "9000"
+}
+
+func (crateMover9000) Move(stack crateStack, inst craneInstruction) {
+	stack.move9000(inst)
+}
+
+type crateMover9001 struct{}
+
+func (crateMover9001) Name() string {
+	return "9001"
+}
+
+func (crateMover9001) Move(stack crateStack, inst craneInstruction) {
+	stack.move9001(inst)
+}
+
+// batchCrane picks up at most batchSize crates at once, keeping the order of
+// the crates within each batch.
+type batchCrane struct {
+	batchSize int
+}
+
+func (c batchCrane) Name() string {
+	return fmt.Sprintf("batch-%d", c.batchSize)
+}
+
+func (c batchCrane) Move(stack crateStack, inst craneInstruction) {
+	for remaining := inst.amount; remaining > 0; remaining -= c.batchSize {
+		batch := inst
+		batch.amount = min(remaining, c.batchSize)
+		stack.move9001(batch)
+	}
+}
+
+var craneModels = map[string]CraneModel{}
+
+func registerCraneModel(model CraneModel) {
+	craneModels[model.Name()] = model
+}
+
+func init() {
+	registerCraneModel(crateMover9000{})
+	registerCraneModel(crateMover9001{})
+}
+
+// getCraneModel looks up a registered crane model by name. Batch cranes are
+// created on demand from names of the form "batch-K".
+func getCraneModel(name string) (CraneModel, error) {
+	if model, ok := craneModels[name]; ok {
+		return model, nil
+	}
+
+	var batchSize int
+	if _, err := fmt.Sscanf(name, "batch-%d", &batchSize); err == nil {
+		if batchSize < 1 {
+			return nil, fmt.Errorf("invalid batch size %d", batchSize)
+		}
+		return batchCrane{batchSize: batchSize}, nil
+	}
+
+	return nil, fmt.Errorf("unknown crane model %q", name)
 }
 
 type crateStack struct {
 	crates [][]byte
 }
 
+// String draws the stacks top-down in the same bracketed format as the
+// puzzle input, including the stack-number line.
 func (s crateStack) String() string {
-	return string(bytes.Join(s.crates, []byte("\n")))
+	height := 0
+	for _, column := range s.crates {
+		height = max(height, len(column))
+	}
+
+	drawing := strings.Builder{}
+	row := make([]byte, 0, len(s.crates)*4)
+
+	for level := height - 1; level >= 0; level-- {
+		row = row[:0]
+		for _, column := range s.crates {
+			if level < len(column) {
+				row = append(row, '[', column[level], ']', ' ')
+			} else {
+				row = append(row, "    "...)
+			}
+		}
+		drawing.Write(bytes.TrimRight(row, " "))
+		drawing.WriteByte('\n')
+	}
+
+	row = row[:0]
+	for i := range s.crates {
+		row = append(row, fmt.Sprintf(" %-2d ", i+1)...)
+	}
+	drawing.Write(bytes.TrimRight(row, " "))
+
+	return drawing.String()
+}
+
+func (s crateStack) clone() crateStack {
+	crates := make([][]byte, len(s.crates))
+	for i, c := range s.crates {
+		crates[i] = make([]byte, len(c))
+		copy(crates[i], c)
+	}
+
+	return crateStack{crates: crates}
+}
+
+func (s crateStack) validate(inst craneInstruction) error {
+	if inst.source < 1 || inst.source > len(s.crates) {
+		return fmt.Errorf("source stack %d does not exist", inst.source)
+	}
+	if inst.dest < 1 || inst.dest > len(s.crates) {
+		return fmt.Errorf("destination stack %d does not exist", inst.dest)
+	}
+	if inst.amount < 0 {
+		return fmt.Errorf("cannot move a negative amount of crates")
+	}
+	if held := len(s.crates[inst.source-1]); inst.amount > held {
+		return fmt.Errorf(
+			"cannot move %d crates from stack %d holding only %d",
+			inst.amount, inst.source, held,
+		)
+	}
+
+	return nil
+}
+
+// rearrange validates and carries out every step of a procedure in order,
+// stopping at the first step that cannot be carried out.
+func (s crateStack) rearrange(
+	model CraneModel,
+	steps []craneInstruction,
+) error {
+	for i, step := range steps {
+		if err := s.validate(step); err != nil {
+			return fmt.Errorf("step %d (%v): %w", i+1, step, err)
+		}
+
+		model.Move(s, step)
+	}
+
+	return nil
 }
 
 func (s crateStack) move9000(inst craneInstruction) {
@@ -59,6 +222,159 @@ func (s crateStack) move9001(inst craneInstruction) {
 	s.crates[dIdx] = append(s.crates[dIdx], c...)
 }
 
+// craneReplay steps through a procedure one instruction at a time, keeping a
+// snapshot of the stacks before each step so that any model can be undone.
+type craneReplay struct {
+	model   CraneModel
+	steps   []craneInstruction
+	stack   crateStack
+	history []crateStack
+}
+
+func newCraneReplay(
+	stack crateStack,
+	model CraneModel,
+	steps []craneInstruction,
+) *craneReplay {
+	return &craneReplay{
+		model:   model,
+		steps:   steps,
+		stack:   stack.clone(),
+		history: []crateStack{},
+	}
+}
+
+// step returns how many instructions have been carried out so far.
+func (r *craneReplay) step() int {
+	return len(r.history)
+}
+
+func (r *craneReplay) done() bool {
+	return r.step() == len(r.steps)
+}
+
+func (r *craneReplay) forward() error {
+	if r.done() {
+		return errors.New("already at the last step")
+	}
+
+	n := r.step()
+	inst := r.steps[n]
+	if err := r.stack.validate(inst); err != nil {
+		return fmt.Errorf("step %d (%v): %w", n+1, inst, err)
+	}
+
+	r.history = append(r.history, r.stack.clone())
+	r.model.Move(r.stack, inst)
+
+	return nil
+}
+
+func (r *craneReplay) undo() error {
+	if r.step() == 0 {
+		return errors.New("already at the first step")
+	}
+
+	last := len(r.history) - 1
+	r.stack = r.history[last]
+	r.history = r.history[:last]
+
+	return nil
+}
+
+func (r *craneReplay) jump(step int) error {
+	if step < 0 || step > len(r.steps) {
+		return fmt.Errorf("step %d is outside 0 to %d", step, len(r.steps))
+	}
+
+	if step < r.step() {
+		r.stack = r.history[step]
+		r.history = r.history[:step]
+	}
+	for r.step() < step {
+		if err := r.forward(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *craneReplay) render() string {
+	title := fmt.Sprintf(
+		"CrateMover %s, step %d/%d",
+		r.model.Name(), r.step(), len(r.steps),
+	)
+	if n := r.step(); n > 0 {
+		title += fmt.Sprintf(": %v", r.steps[n-1])
+	}
+
+	return title + "\n\n" + r.stack.String() + "\n"
+}
+
+func (s crateStack) equal(o crateStack) bool {
+	if len(s.crates) != len(o.crates) {
+		return false
+	}
+	for i := range s.crates {
+		if !bytes.Equal(s.crates[i], o.crates[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// inverse returns the instruction that puts back the crates moved by i.
+// Running the same crane model with the inverse instruction undoes the move
+// for each of the built-in models, as each crane reverses the order of the
+// crates it carries in the same way in both directions.
+func (i craneInstruction) inverse() craneInstruction {
+	return craneInstruction{source: i.dest, dest: i.source, amount: i.amount}
+}
+
+// unrearrange derives the starting stacks from the final stacks by applying
+// the inverse of every step in reverse order.
+func (s crateStack) unrearrange(
+	model CraneModel,
+	steps []craneInstruction,
+) error {
+	for i := len(steps) - 1; i >= 0; i-- {
+		inv := steps[i].inverse()
+		if err := s.validate(inv); err != nil {
+			return fmt.Errorf("undoing step %d (%v): %w", i+1, steps[i], err)
+		}
+
+		model.Move(s, inv)
+	}
+
+	return nil
+}
+
+// solveStartingStacks reconstructs the starting stacks for the given model
+// and checks the result by replaying the procedure forward again.
+func solveStartingStacks(
+	final crateStack,
+	model CraneModel,
+	steps []craneInstruction,
+) (crateStack, error) {
+	start := final.clone()
+	if err := start.unrearrange(model, steps); err != nil {
+		return crateStack{}, err
+	}
+
+	replayed := start.clone()
+	if err := replayed.rearrange(model, steps); err != nil {
+		return crateStack{}, fmt.Errorf("replaying solved stacks: %w", err)
+	}
+	if !replayed.equal(final) {
+		return crateStack{}, errors.New(
+			"replaying the solved stacks does not reach the final stacks",
+		)
+	}
+
+	return start, nil
+}
+
 func (s crateStack) getTopCrates() string {
 	chars := []byte{}
 
@@ -74,88 +390,367 @@ func (s crateStack) getTopCrates() string {
 	return string(chars)
 }
 
-func parseCrates(input string) [][]byte {
-	inputRows := strings.Split(input, "\n")
+type stackLabel struct {
+	number     int
+	start, end int
+}
+
+// parseStackLabels reads the stack-number line underneath a crate drawing,
+// recording which columns of the drawing each number occupies. The stacks
+// must be numbered 1 to N from left to right.
+func parseStackLabels(line string) ([]stackLabel, error) {
+	labels := []stackLabel{}
+
+	for i := 0; i < len(line); {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+		if line[i] < '0' || line[i] > '9' {
+			return nil, fmt.Errorf(
+				"unexpected character %q at column %d of stack-number line",
+				line[i], i+1,
+			)
+		}
 
-	rows := [][]byte{}
-	for _, inputRow := range inputRows {
-		if inputRow[0] != '[' {
-			break
+		label := stackLabel{start: i}
+		for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+			label.number = label.number*10 + int(line[i]-'0')
+			i++
 		}
+		label.end = i - 1
 
-		row := []byte{}
-		for i := 0; i < len(inputRow); i += 4 {
-			var crate byte
-			fmt.Sscanf(inputRow[i:], "[%c]", &crate)
-			row = append(row, crate)
+		if label.number != len(labels)+1 {
+			return nil, fmt.Errorf(
+				"stack number %d at column %d is out of order, expected %d",
+				label.number, label.start+1, len(labels)+1,
+			)
 		}
 
-		rows = append(rows, row)
+		labels = append(labels, label)
 	}
 
-	columns := make([][]byte, len(rows[0]))
-	for i := range columns {
-		columns[i] = make([]byte, len(rows))
+	if len(labels) == 0 {
+		return nil, errors.New("stack-number line has no stack numbers")
 	}
 
-	for i := range rows {
-		for j := range rows[i] {
-			idx := len(rows) - i - 1
-			columns[j][idx] = rows[i][j]
+	return labels, nil
+}
+
+func findStack(labels []stackLabel, column int) int {
+	for i, label := range labels {
+		if column >= label.start && column <= label.end {
+			return i
 		}
 	}
+	return -1
+}
 
+// parseCrates reads a crate drawing, with the stack-number line as its last
+// line, into one column of crates per stack, listed bottom to top. Rows may
+// be ragged or shorter than the stack-number line.
+func parseCrates(drawing string) ([][]byte, error) {
+	lines := strings.Split(strings.TrimRight(drawing, " \n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[len(lines)-1]) == "" {
+		return nil, errors.New("crate drawing is empty")
+	}
+
+	labelLine := len(lines) - 1
+	labels, err := parseStackLabels(lines[labelLine])
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", labelLine+1, err)
+	}
+
+	columns := make([][]byte, len(labels))
 	for i := range columns {
-		columns[i] = bytes.Trim(columns[i], "\x00")
+		columns[i] = []byte{}
+	}
+
+	for l := labelLine - 1; l >= 0; l-- {
+		row := lines[l]
+		level := labelLine - 1 - l
+
+		for i := 0; i < len(row); i++ {
+			if row[i] == ' ' {
+				continue
+			}
+			if row[i] != '[' || i+2 >= len(row) || row[i+2] != ']' {
+				return nil, fmt.Errorf(
+					"line %d: malformed crate at column %d, expected \"[X]\"",
+					l+1, i+1,
+				)
+			}
+
+			crate := row[i+1]
+			stack := findStack(labels, i+1)
+			if stack == -1 {
+				return nil, fmt.Errorf(
+					"line %d: crate %q at column %d is not above a stack number",
+					l+1, crate, i+2,
+				)
+			}
+			if len(columns[stack]) != level {
+				return nil, fmt.Errorf(
+					"line %d: crate %q in stack %d is floating above an empty space",
+					l+1, crate, labels[stack].number,
+				)
+			}
+
+			columns[stack] = append(columns[stack], crate)
+			i += 2
+		}
 	}
 
-	return columns
+	return columns, nil
+}
+
+// splitInput separates the crate drawing from the rearrangement procedure
+// at the first blank line.
+func splitInput(input string) (drawing, procedure string, err error) {
+	input = strings.ReplaceAll(input, "\r\n", "\n")
+	input = strings.TrimLeft(input, "\n")
+
+	sections := strings.SplitN(input, "\n\n", 2)
+	if len(sections) < 2 {
+		return "", "", errors.New(
+			"input has no blank line between the drawing and the procedure",
+		)
+	}
+
+	return sections[0], strings.TrimSpace(sections[1]), nil
 }
 
 func main() {
+	craneName := flag.String(
+		"crane",
+		"",
+		"only run the crane model `name` (9000, 9001 or batch-K)",
+	)
+	play := flag.Bool("play", false, "animate the procedure in the terminal")
+	delay := flag.Duration("delay", 100*time.Millisecond, "delay between frames")
+	interactive := flag.Bool(
+		"interactive",
+		false,
+		"step through the procedure with commands read from stdin",
+	)
+	showStep := flag.Int("step", -1, "draw the stacks after step `n`")
+	reverseFile := flag.String(
+		"reverse",
+		"",
+		"derive the starting stacks from the final drawing in `file`",
+	)
+	check := flag.Bool(
+		"check",
+		false,
+		"check that every crane model round-trips the input procedure",
+	)
+	flag.Parse()
+
 	bytes, err := os.ReadFile("input.txt")
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
 
-	input := strings.TrimSpace(string(bytes))
+	drawing, procedure, err := splitInput(string(bytes))
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
 
-	sections := strings.SplitAfterN(input, "9", 2)
-	if len(sections) < 2 {
-		panic("not enough input sections")
+	columns, err := parseCrates(drawing)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
 	}
 
-	columns := parseCrates(sections[0])
-	columns2 := make([][]byte, len(columns))
-	for i, c := range columns {
-		columns2[i] = make([]byte, len(columns[i]))
-		copy(columns2[i], c)
+	moveSteps, err := parseCraneInstructions(procedure)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
 	}
 
 	stack := crateStack{crates: columns}
-	stack2 := crateStack{crates: columns2}
 
-	moveSteps := parseCraneInstructions(strings.TrimSpace(sections[1]))
+	if *reverseFile != "" {
+		if err := reverse(*reverseFile, moveSteps); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *check {
+		if err := checkRoundTrips(stack, moveSteps); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *play || *interactive || *showStep >= 0 {
+		name := *craneName
+		if name == "" {
+			name = crateMover9000{}.Name()
+		}
+		model, err := getCraneModel(name)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		replay := newCraneReplay(stack, model, moveSteps)
+		switch {
+		case *play:
+			err = playReplay(replay, *delay)
+		case *interactive:
+			err = runInteractive(replay, os.Stdin)
+		default:
+			err = replay.jump(*showStep)
+			fmt.Print(replay.render())
+		}
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *craneName != "" {
+		model, err := getCraneModel(*craneName)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		runCrane(stack, model, moveSteps)
+		return
+	}
 
-	part1(stack, moveSteps)
-	part2(stack2, moveSteps)
+	part1(stack.clone(), moveSteps)
+	part2(stack.clone(), moveSteps)
 }
 
-func part1(stack crateStack, moveSteps []craneInstruction) {
-	for _, step := range moveSteps {
-		stack.move9000(step)
+func reverse(finalFile string, moveSteps []craneInstruction) error {
+	bytes, err := os.ReadFile(finalFile)
+	if err != nil {
+		return err
+	}
+
+	columns, err := parseCrates(string(bytes))
+	if err != nil {
+		return fmt.Errorf("%s: %w", finalFile, err)
+	}
+	final := crateStack{crates: columns}
+
+	for _, model := range []CraneModel{crateMover9000{}, crateMover9001{}} {
+		start, err := solveStartingStacks(final, model, moveSteps)
+		if err != nil {
+			return fmt.Errorf("crane model %s: %w", model.Name(), err)
+		}
+
+		fmt.Printf("Starting stacks for the CrateMover %s:\n", model.Name())
+		fmt.Println(start)
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func checkRoundTrips(stack crateStack, moveSteps []craneInstruction) error {
+	for _, model := range []CraneModel{crateMover9000{}, crateMover9001{}} {
+		final := stack.clone()
+		if err := final.rearrange(model, moveSteps); err != nil {
+			return fmt.Errorf("crane model %s: %w", model.Name(), err)
+		}
+
+		start, err := solveStartingStacks(final, model, moveSteps)
+		if err != nil {
+			return fmt.Errorf("crane model %s: %w", model.Name(), err)
+		}
+		if !start.equal(stack) {
+			return fmt.Errorf(
+				"crane model %s: solved starting stacks differ from the input",
+				model.Name(),
+			)
+		}
+
+		fmt.Printf("CrateMover %s round-trips the procedure\n", model.Name())
+	}
+
+	return nil
+}
+
+func runCrane(stack crateStack, model CraneModel, moveSteps []craneInstruction) {
+	if err := stack.rearrange(model, moveSteps); err != nil {
+		log.Printf("crane model %s: %v\n", model.Name(), err)
+		os.Exit(1)
 	}
 
 	topCrates := stack.getTopCrates()
 	log.Println("The top crates after sorting are:", topCrates)
 }
 
+func part1(stack crateStack, moveSteps []craneInstruction) {
+	runCrane(stack, crateMover9000{}, moveSteps)
+}
+
 func part2(stack crateStack, moveSteps []craneInstruction) {
-	for _, step := range moveSteps {
-		stack.move9001(step)
+	runCrane(stack, crateMover9001{}, moveSteps)
+}
+
+const clearScreen = "\033[H\033[2J"
+
+func playReplay(replay *craneReplay, delay time.Duration) error {
+	for {
+		fmt.Print(clearScreen, replay.render())
+		if replay.done() {
+			return nil
+		}
+
+		time.Sleep(delay)
+		if err := replay.forward(); err != nil {
+			return err
+		}
 	}
+}
 
-	topCrates := stack.getTopCrates()
-	log.Println("The top crates after sorting are:", topCrates)
+func runInteractive(replay *craneReplay, input io.Reader) error {
+	fmt.Print(replay.render())
+	fmt.Println("Commands: n(ext), b(ack), j(ump) <step>, q(uit)")
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		var err error
+		switch args[0] {
+		case "n", "next":
+			err = replay.forward()
+		case "b", "back":
+			err = replay.undo()
+		case "j", "jump":
+			var step int
+			if len(args) < 2 {
+				err = errors.New("jump needs a step number")
+			} else if step, err = strconv.Atoi(args[1]); err == nil {
+				err = replay.jump(step)
+			}
+		case "q", "quit":
+			return nil
+		default:
+			err = fmt.Errorf("unknown command %q", args[0])
+		}
+
+		if err != nil {
+			fmt.Println("error:", err)
+			continue
+		}
+		fmt.Print(replay.render())
+	}
+
+	return scanner.Err()
 }
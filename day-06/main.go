@@ -1,9 +1,15 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -11,30 +17,432 @@ const (
 	startOfMessageSize = 14
 )
 
-func findUniquePacket(input []byte, packetSize int) int {
-	for i := packetSize; i < len(input); i++ {
-		total := 0
-		chunk := input[i-packetSize : i]
-		for _, c := range chunk {
-			total += bytes.Count(chunk, []byte{c})
+var errMarkerNotFound = errors.New("marker not found")
+
+// markerDetector keeps a rolling count of the characters in the last size
+// characters of a datastream, along with how many of those characters are
+// repeats, so each new character is checked in constant time.
+type markerDetector struct {
+	size     int
+	counts   [256]int
+	repeats  int
+	position int
+}
+
+func (d *markerDetector) reset() {
+	*d = markerDetector{size: d.size}
+}
+
+func (d *markerDetector) found() bool {
+	return d.position > 0
+}
+
+// push adds the character at the given position of the stream to the
+// window, removing dropped if the window is already full.
+func (d *markerDetector) push(c byte, dropped byte, position int) {
+	if position > d.size {
+		d.counts[dropped]--
+		if d.counts[dropped] > 0 {
+			d.repeats--
+		}
+	}
+
+	if d.counts[c] > 0 {
+		d.repeats++
+	}
+	d.counts[c]++
+
+	if !d.found() && position >= d.size && d.repeats == 0 {
+		d.position = position
+	}
+}
+
+// findMarkers reads a datastream once and returns, for each of the given
+// marker sizes, the number of characters read by the end of the first marker
+// of that many unique characters. Sizes with no marker are left out of the
+// result. Line breaks in the stream are ignored.
+func findMarkers(r io.Reader, sizes ...int) (map[int]int, error) {
+	detectors := make([]*markerDetector, 0, len(sizes))
+	window := 0
+	for _, size := range sizes {
+		if size < 1 {
+			return nil, fmt.Errorf("invalid marker size %d", size)
 		}
-		if total == packetSize {
-			return i
+		detectors = append(detectors, &markerDetector{size: size})
+		if size > window {
+			window = size
 		}
 	}
-	return 0
+
+	// ring holds the last window characters plus the one before them, so
+	// every detector can look up the character leaving its own window.
+	window++
+	ring := make([]byte, window)
+	reader := bufio.NewReader(r)
+	position := 0
+	remaining := len(detectors)
+
+	for remaining > 0 {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c == '\n' || c == '\r' {
+			continue
+		}
+
+		position++
+		ring[position%window] = c
+
+		for _, d := range detectors {
+			if d.found() {
+				continue
+			}
+
+			dropped := ring[((position-d.size)%window+window)%window]
+			d.push(c, dropped, position)
+			if d.found() {
+				remaining--
+			}
+		}
+	}
+
+	markers := make(map[int]int)
+	for _, d := range detectors {
+		if d.found() {
+			markers[d.size] = d.position
+		}
+	}
+
+	return markers, nil
+}
+
+// markerKind says which marker a frame of a datastream starts with.
+type markerKind int
+
+const (
+	noMarker markerKind = iota
+	packetMarker
+	messageMarker
+)
+
+func (k markerKind) String() string {
+	switch k {
+	case packetMarker:
+		return "packet"
+	case messageMarker:
+		return "message"
+	default:
+		return "preamble"
+	}
+}
+
+// frame is one segment of a datastream, made up of a marker and the payload
+// following it up to the next marker. Data before the first marker is
+// returned as a frame with no marker. Offsets count from 0 and skip line
+// breaks, like marker positions.
+type frame struct {
+	kind    markerKind
+	offset  int
+	marker  []byte
+	payload []byte
+}
+
+func (f frame) payloadOffset() int {
+	return f.offset + len(f.marker)
+}
+
+func (f frame) String() string {
+	const previewSize = 32
+
+	payload := string(f.payload)
+	if len(payload) > previewSize {
+		payload = payload[:previewSize] + "..."
+	}
+
+	return fmt.Sprintf(
+		"%6d: %-8v marker %q, payload at %d (%d bytes) %q",
+		f.offset, f.kind, f.marker, f.payloadOffset(), len(f.payload), payload,
+	)
+}
+
+// frameReader splits a datastream into a packet and the messages it
+// carries. The first start-of-packet marker opens the packet, whose header
+// runs up to the first start-of-message marker. From then on the stream is a
+// run of messages, each made up of a start-of-message marker and the payload
+// up to the next one or the end of the stream. Start-of-packet markers are
+// not looked for inside the packet, as every start-of-message marker contains
+// them. Markers never overlap: after each marker the search for the next one
+// starts again from scratch.
+type frameReader struct {
+	reader    *bufio.Reader
+	detectors map[markerKind]*markerDetector
+	kind      markerKind
+	marker    []byte
+	pending   []byte
+	offset    int
+	done      bool
+}
+
+func newFrameReader(r io.Reader, packetSize, messageSize int) *frameReader {
+	return &frameReader{
+		reader: bufio.NewReader(r),
+		detectors: map[markerKind]*markerDetector{
+			packetMarker:  {size: packetSize},
+			messageMarker: {size: messageSize},
+		},
+	}
+}
+
+// expecting returns the kind of marker that ends the current frame.
+func (f *frameReader) expecting() markerKind {
+	if f.kind == noMarker {
+		return packetMarker
+	}
+	return messageMarker
+}
+
+// Next returns the next frame of the stream, or io.EOF once every frame has
+// been returned.
+func (f *frameReader) Next() (frame, error) {
+	for !f.done {
+		c, err := f.reader.ReadByte()
+		if err == io.EOF {
+			f.done = true
+			break
+		}
+		if err != nil {
+			return frame{}, err
+		}
+		if c == '\n' || c == '\r' {
+			continue
+		}
+
+		f.pending = append(f.pending, c)
+
+		next := f.expecting()
+		detector := f.detectors[next]
+		n := len(f.pending)
+		var dropped byte
+		if n > detector.size {
+			dropped = f.pending[n-1-detector.size]
+		}
+		detector.push(c, dropped, n)
+		if !detector.found() {
+			continue
+		}
+
+		markerStart := n - detector.size
+		finished := frame{
+			kind:    f.kind,
+			offset:  f.offset,
+			marker:  f.marker,
+			payload: f.pending[:markerStart],
+		}
+
+		f.offset += len(f.marker) + markerStart
+		f.kind = next
+		f.marker = f.pending[markerStart:]
+		f.pending = nil
+		detector.reset()
+
+		if finished.marker != nil || len(finished.payload) > 0 {
+			return finished, nil
+		}
+	}
+
+	if f.marker == nil && len(f.pending) == 0 {
+		return frame{}, io.EOF
+	}
+
+	last := frame{
+		kind:    f.kind,
+		offset:  f.offset,
+		marker:  f.marker,
+		payload: f.pending,
+	}
+	f.marker, f.pending = nil, nil
+	return last, nil
+}
+
+// messageReader is an io.Reader over the messages in a datastream. Each
+// message's payload is followed by a newline, so messages can be read one by
+// one with a bufio.Scanner.
+type messageReader struct {
+	frames  *frameReader
+	current []byte
+}
+
+func newMessageReader(r io.Reader, packetSize, messageSize int) *messageReader {
+	return &messageReader{frames: newFrameReader(r, packetSize, messageSize)}
+}
+
+func (m *messageReader) Read(p []byte) (int, error) {
+	for len(m.current) == 0 {
+		f, err := m.frames.Next()
+		if err != nil {
+			return 0, err
+		}
+		if f.kind == messageMarker {
+			m.current = append(f.payload[:len(f.payload):len(f.payload)], '\n')
+		}
+	}
+
+	n := copy(p, m.current)
+	m.current = m.current[n:]
+	return n, nil
+}
+
+// decodeStream reads every frame from a datastream.
+func decodeStream(r io.Reader, packetSize, messageSize int) ([]frame, error) {
+	frames := []frame{}
+	reader := newFrameReader(r, packetSize, messageSize)
+
+	for {
+		f, err := reader.Next()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		frames = append(frames, f)
+	}
+}
+
+func parseSizes(list string) ([]int, error) {
+	sizes := []int{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		size, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid marker size %q", field)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
 }
 
 func main() {
-	input, err := os.ReadFile("input.txt")
+	inputFile := flag.String(
+		"input",
+		"input.txt",
+		"datastream to read, or - to read from stdin",
+	)
+	extraSizes := flag.String(
+		"sizes",
+		"",
+		"comma-separated list of extra marker sizes to look for",
+	)
+	packetSize := flag.Int(
+		"packet-size",
+		startOfPacketSize,
+		"number of unique characters in a start-of-packet marker",
+	)
+	messageSize := flag.Int(
+		"message-size",
+		startOfMessageSize,
+		"number of unique characters in a start-of-message marker",
+	)
+	decoding := flag.String(
+		"decode",
+		"",
+		"split the whole stream into packets and messages, listing every "+
+			"`frame` or printing each message",
+	)
+	flag.Parse()
+
+	sizes, err := parseSizes(*extraSizes)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	input := os.Stdin
+	if *inputFile != "-" {
+		input, err = os.Open(*inputFile)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		defer input.Close()
+	}
+
+	if *decoding != "" {
+		err := decode(input, *decoding, *packetSize, *messageSize)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	sizes = append([]int{*packetSize, *messageSize}, sizes...)
+	markers, err := findMarkers(input, sizes...)
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
 
-	startOfPacket := findUniquePacket(input, startOfPacketSize)
-	startOfMessage := findUniquePacket(input, startOfMessageSize)
+	logMarker("The start of the packet is at:", markers, *packetSize)
+	logMarker("The start of the message is at:", markers, *messageSize)
+	for _, size := range sizes[2:] {
+		logMarker(
+			fmt.Sprintf("The first %d-character marker is at:", size),
+			markers,
+			size,
+		)
+	}
+}
+
+func logMarker(message string, markers map[int]int, size int) {
+	position, ok := markers[size]
+	if !ok {
+		log.Println(message, errMarkerNotFound)
+		return
+	}
+
+	log.Println(message, position)
+}
+
+func decode(input io.Reader, decoding string, packetSize, messageSize int) error {
+	if packetSize < 1 || messageSize < 1 {
+		return fmt.Errorf("invalid marker sizes %d and %d", packetSize, messageSize)
+	}
+
+	switch decoding {
+	case "frame", "frames":
+		frames, err := decodeStream(input, packetSize, messageSize)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf(
+			"The datastream splits into %d frames using %d-character packet "+
+				"and %d-character message markers:\n",
+			len(frames), packetSize, messageSize,
+		)
+		for _, f := range frames {
+			fmt.Println(f)
+		}
+	case "message", "messages":
+		messages := newMessageReader(input, packetSize, messageSize)
+		scanner := bufio.NewScanner(messages)
+		for n := 1; scanner.Scan(); n++ {
+			fmt.Printf("Message %d: %s\n", n, scanner.Text())
+		}
+		return scanner.Err()
+	default:
+		return fmt.Errorf("unknown decoding %q", decoding)
+	}
 
-	log.Println("The start of the packet is at:", startOfPacket)
-	log.Println("The start of the message is at:", startOfMessage)
+	return nil
 }
@@ -1,16 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"math/bits"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 const (
-	maxSize           int64 = 100000
-	totalDiskSpace    int64 = 70000000
-	requiredDiskSpace int64 = 30000000
+	defaultMaxSize           int64 = 100000
+	defaultTotalDiskSpace    int64 = 70000000
+	defaultRequiredDiskSpace int64 = 30000000
 )
 
 type fileSystem struct {
@@ -18,60 +28,117 @@ type fileSystem struct {
 	cwd  *directory
 }
 
-func (fs *fileSystem) addDir(name string) {
+// addDir adds a directory to the current directory, keeping the existing
+// directory and its contents if it has already been added.
+func (fs *fileSystem) addDir(name string) (*directory, error) {
+	switch existing := fs.cwd.children[name].(type) {
+	case *directory:
+		return existing, nil
+	case *file:
+		return nil, fmt.Errorf("%q is already listed as a file", name)
+	}
+
 	newDir := directory{
-		name:     strings.TrimSpace(name),
+		name:     name,
 		parent:   fs.cwd,
 		children: make(map[string]diskEntity),
 	}
 	fs.cwd.children[name] = &newDir
+	fs.cwd.invalidateSize()
+
+	return &newDir, nil
 }
 
-func (fs *fileSystem) addFile(size int64, name string) {
+func (fs *fileSystem) addFile(size int64, name string) error {
+	switch existing := fs.cwd.children[name].(type) {
+	case *directory:
+		return fmt.Errorf("%q is already listed as a directory", name)
+	case *file:
+		if existing.size != size {
+			return fmt.Errorf(
+				"file %q listed with size %d, previously listed with size %d",
+				name, size, existing.size,
+			)
+		}
+		return nil
+	}
+
 	newFile := file{
-		name: strings.TrimSpace(name),
+		name: name,
 		size: size,
 	}
 	fs.cwd.children[name] = &newFile
+	fs.cwd.invalidateSize()
+
+	return nil
 }
 
-func (fs *fileSystem) cd(dir string) {
-	if dir == "/" {
+// cd moves into a directory, creating it if it was never listed. Moving up
+// from the root stays at the root.
+func (fs *fileSystem) cd(dir string) error {
+	switch dir {
+	case "/":
 		fs.cwd = fs.root
-		return
+		return nil
+	case "..":
+		if fs.cwd.parent != nil {
+			fs.cwd = fs.cwd.parent
+		}
+		return nil
+	case "", ".":
+		return nil
 	}
-	if dir == ".." {
-		fs.cwd = fs.cwd.parent
-		return
+
+	if strings.Contains(dir, "/") {
+		return fmt.Errorf("cannot cd into nested path %q", dir)
 	}
 
-	diskDir := fs.cwd.children[dir]
-	fs.cwd = diskDir.(*directory)
+	diskDir, err := fs.addDir(dir)
+	if err != nil {
+		return err
+	}
+
+	fs.cwd = diskDir
+	return nil
 }
 
-func (fs *fileSystem) ls(list []string) {
-	for _, entry := range list {
-		words := strings.Split(entry, " ")
-		switch words[0] {
-		case "dir":
-			fs.addDir(words[1])
-		default:
-			size, _ := strconv.ParseInt(words[0], 10, 64)
-			fs.addFile(size, words[1])
-		}
+// ls records a single line of ls output in the current directory.
+func (fs *fileSystem) ls(entry string) error {
+	words := strings.SplitN(entry, " ", 2)
+	if len(words) < 2 || words[1] == "" {
+		return fmt.Errorf("malformed ls entry %q", entry)
+	}
+
+	if words[0] == "dir" {
+		_, err := fs.addDir(words[1])
+		return err
+	}
+
+	size, err := strconv.ParseInt(words[0], 10, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("invalid file size %q", words[0])
 	}
+
+	return fs.addFile(size, words[1])
 }
 
-func (fs fileSystem) getSizeSum() int64 {
-	return fs.root.getInnerSizeSumMax()
+func (fs fileSystem) getSizeSum(limit int64) int64 {
+	return fs.root.sumSizesAtMost(limit)
 }
 
-func (fs fileSystem) getSmallestEligibleDirectory() int64 {
-	used := fs.root.Size()
-	remaining := totalDiskSpace - used
-	needed := requiredDiskSpace - remaining
+// getSmallestEligibleDirectory finds the size of the smallest directory that
+// frees up enough space for the required space to be available on a disk of
+// the given size.
+func (fs fileSystem) getSmallestEligibleDirectory(diskSpace, required int64) int64 {
+	used := fs.root.computeSizes()
+	remaining := diskSpace - used
+	needed := required - remaining
 
-	return fs.root.findClosestNeededSize(needed, used)
+	dir, ok := fs.root.smallestAtLeast(needed)
+	if !ok {
+		return 0
+	}
+	return dir.Size()
 }
 
 func newRootFileSystem() *fileSystem {
@@ -87,6 +154,50 @@ func newRootFileSystem() *fileSystem {
 	}
 }
 
+// resolve finds the entity at the given path, which may be absolute or
+// relative to the current directory and may contain "." and "..". It also
+// returns the cleaned absolute path of the entity.
+func (fs fileSystem) resolve(p string) (diskEntity, string, error) {
+	if !path.IsAbs(p) {
+		p = path.Join(fs.cwd.path(), p)
+	}
+	p = path.Clean(p)
+
+	var entity diskEntity = fs.root
+	for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		dir, ok := entity.(*directory)
+		if !ok {
+			return nil, "", fmt.Errorf("%s: not a directory", p)
+		}
+
+		entity, ok = dir.children[name]
+		if !ok {
+			return nil, "", fmt.Errorf("%s: no such file or directory", p)
+		}
+	}
+
+	return entity, p, nil
+}
+
+func (fs *fileSystem) changeDir(p string) error {
+	entity, p, err := fs.resolve(p)
+	if err != nil {
+		return err
+	}
+
+	dir, ok := entity.(*directory)
+	if !ok {
+		return fmt.Errorf("%s: not a directory", p)
+	}
+
+	fs.cwd = dir
+	return nil
+}
+
 type diskEntity interface {
 	Size() int64
 }
@@ -95,47 +206,125 @@ type directory struct {
 	name     string
 	parent   *directory
 	children map[string]diskEntity
+
+	size       int64
+	sizeCached bool
 }
 
-func (d directory) Size() int64 {
+func (d *directory) path() string {
+	if d.parent == nil {
+		return "/"
+	}
+	return path.Join(d.parent.path(), d.name)
+}
+
+func (d *directory) sortedNames() []string {
+	names := make([]string, 0, len(d.children))
+	for name := range d.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Size returns the total size of the directory, computing the sizes of the
+// whole subtree first if any of them are out of date.
+func (d *directory) Size() int64 {
+	if !d.sizeCached {
+		d.computeSizes()
+	}
+	return d.size
+}
+
+// computeSizes caches the size of every directory in the subtree in a single
+// post-order pass, skipping subtrees whose sizes are still cached.
+func (d *directory) computeSizes() int64 {
+	if d.sizeCached {
+		return d.size
+	}
+
 	var size int64 = 0
 	for _, c := range d.children {
-		size += c.Size()
+		if dir, ok := c.(*directory); ok {
+			size += dir.computeSizes()
+		} else {
+			size += c.Size()
+		}
 	}
+
+	d.size = size
+	d.sizeCached = true
 	return size
 }
 
-func (d directory) getInnerSizeSumMax() int64 {
-	var total int64 = 0
-
-	size := d.Size()
-	if size <= maxSize {
-		total += size
+// invalidateSize marks the cached size of the directory and every directory
+// above it as out of date after the directory's contents have changed.
+func (d *directory) invalidateSize() {
+	for dir := d; dir != nil && dir.sizeCached; dir = dir.parent {
+		dir.sizeCached = false
 	}
+}
 
-	for _, entity := range d.children {
-		if dir, ok := entity.(*directory); ok {
-			total += dir.getInnerSizeSumMax()
+// walkDirs calls fn for the directory and every directory below it, in
+// post-order.
+func (d *directory) walkDirs(fn func(dir *directory)) {
+	for _, c := range d.children {
+		if dir, ok := c.(*directory); ok {
+			dir.walkDirs(fn)
 		}
 	}
+	fn(d)
+}
+
+// sumSizesAtMost sums the sizes of every directory no bigger than limit,
+// counting nested directories as many times as they appear.
+func (d *directory) sumSizesAtMost(limit int64) int64 {
+	d.computeSizes()
+
+	var total int64 = 0
+	d.walkDirs(func(dir *directory) {
+		if dir.size <= limit {
+			total += dir.size
+		}
+	})
 
 	return total
 }
 
-func (d directory) findClosestNeededSize(needed, closest int64) int64 {
-	size := d.Size()
-	if size > needed && size < closest {
-		closest = size
-	}
-	for _, ch := range d.children {
-		if dir, ok := ch.(*directory); ok {
-			chClosest := dir.findClosestNeededSize(needed, closest)
-			if chClosest < closest {
-				closest = chClosest
-			}
+// smallestAtLeast finds the smallest directory with a size of at least minSize.
+func (d *directory) smallestAtLeast(minSize int64) (*directory, bool) {
+	d.computeSizes()
+
+	var smallest *directory
+	d.walkDirs(func(dir *directory) {
+		if dir.size >= minSize && (smallest == nil || dir.size < smallest.size) {
+			smallest = dir
 		}
+	})
+
+	return smallest, smallest != nil
+}
+
+// largestDirs returns the k largest directories, largest first.
+func (d *directory) largestDirs(k int) []*directory {
+	d.computeSizes()
+
+	dirs := []*directory{}
+	d.walkDirs(func(dir *directory) {
+		dirs = append(dirs, dir)
+	})
+
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].size != dirs[j].size {
+			return dirs[i].size > dirs[j].size
+		}
+		return dirs[i].path() < dirs[j].path()
+	})
+
+	if k < len(dirs) {
+		dirs = dirs[:k]
 	}
-	return closest
+	return dirs
 }
 
 type file struct {
@@ -147,40 +336,1211 @@ func (f file) Size() int64 {
 	return f.size
 }
 
+const (
+	goalFewestBytes = "bytes"
+	goalFewestItems = "items"
+)
+
+// deletionCandidate is a file or directory that may be deleted as part of a
+// deletion plan.
+type deletionCandidate struct {
+	path  string
+	size  int64
+	isDir bool
+}
+
+type deletionPlan struct {
+	goal   string
+	needed int64
+	items  []deletionCandidate
+	freed  int64
+}
+
+// isWithin reports whether p is dir or is somewhere below it.
+func isWithin(p, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// deletionCandidates lists every file and directory below the root that can
+// be deleted without deleting a protected path, in pre-order.
+func (fs fileSystem) deletionCandidates(protected []string) []deletionCandidate {
+	candidates := []deletionCandidate{}
+
+	var walk func(p string, entity diskEntity)
+	walk = func(p string, entity diskEntity) {
+		for _, prot := range protected {
+			if isWithin(p, prot) {
+				return
+			}
+		}
+
+		dir, isDir := entity.(*directory)
+		guarded := false
+		for _, prot := range protected {
+			if isWithin(prot, p) {
+				guarded = true
+				break
+			}
+		}
+		if p != "/" && !guarded {
+			candidates = append(candidates, deletionCandidate{
+				path:  p,
+				size:  entity.Size(),
+				isDir: isDir,
+			})
+		}
+
+		if isDir {
+			for _, name := range dir.sortedNames() {
+				walk(path.Join(p, name), dir.children[name])
+			}
+		}
+	}
+
+	walk("/", fs.root)
+	return candidates
+}
+
+// planDeletion chooses a set of non-nested files and directories to delete
+// so that at least needed bytes are freed, deleting either the fewest bytes
+// or the fewest items. Protected paths, and any directory holding one, are
+// never deleted.
+func (fs fileSystem) planDeletion(
+	needed int64,
+	goal string,
+	protected []string,
+) (deletionPlan, error) {
+	for i, prot := range protected {
+		_, p, err := fs.resolve(prot)
+		if err != nil {
+			return deletionPlan{}, fmt.Errorf("protected path %v", err)
+		}
+		protected[i] = p
+	}
+
+	plan := deletionPlan{goal: goal, needed: needed, items: []deletionCandidate{}}
+	if needed <= 0 {
+		return plan, nil
+	}
+
+	candidates := fs.deletionCandidates(protected)
+
+	var err error
+	switch goal {
+	case goalFewestBytes:
+		plan.items, err = planFewestBytes(candidates, needed)
+	case goalFewestItems:
+		plan.items, err = planFewestItems(candidates, needed)
+	default:
+		err = fmt.Errorf("unknown deletion goal %q", goal)
+	}
+	if err != nil {
+		return deletionPlan{}, err
+	}
+
+	for _, item := range plan.items {
+		plan.freed += item.size
+	}
+	return plan, nil
+}
+
+const (
+	// maxSubsetSum bounds the sums planFewestBytes tracks one by one, which
+	// keeps its tables to around 70MB.
+	maxSubsetSum = 1 << 24
+	// maxSearchNodes bounds the branch and bound search used for larger
+	// sizes.
+	maxSearchNodes = 50_000_000
+)
+
+// planFewestBytes solves the fewest-bytes goal. Deleting a directory frees
+// exactly as much as deleting every file in it, so this is a subset-sum over
+// the deletable files, after which any directory whose files were all chosen
+// is deleted in their place. Sums too large to track one by one are found
+// with a branch and bound search instead.
+func planFewestBytes(
+	candidates []deletionCandidate,
+	needed int64,
+) ([]deletionCandidate, error) {
+	files := []deletionCandidate{}
+	var total, largest int64
+	for _, c := range candidates {
+		if !c.isDir && c.size > 0 {
+			files = append(files, c)
+			total += c.size
+			largest = max(largest, c.size)
+		}
+	}
+	if total < needed {
+		return nil, fmt.Errorf(
+			"only %d bytes can be deleted, %d are needed",
+			total, needed,
+		)
+	}
+
+	// An optimal plan frees less than needed+largest bytes, or dropping any
+	// one of its files would still free enough. reached is a bitset of the
+	// sums found so far, and from records the file that first reached each
+	// sum, which is enough to walk back to the empty set.
+	limit := needed + largest
+	if limit > maxSubsetSum {
+		chosen, err := searchFewestBytes(files, needed)
+		if err != nil {
+			return nil, err
+		}
+		return compactDeletion(candidates, chosen), nil
+	}
+
+	words := make([]uint64, limit/64+1)
+	from := make([]int32, limit+1)
+	words[0] = 1
+
+	best := int64(-1)
+	for i, f := range files {
+		shift := f.size
+		wordShift, bitShift := int(shift/64), uint(shift%64)
+
+		for w := len(words) - 1; w >= wordShift; w-- {
+			shifted := words[w-wordShift] << bitShift
+			if bitShift > 0 && w-wordShift > 0 {
+				shifted |= words[w-wordShift-1] >> (64 - bitShift)
+			}
+
+			added := shifted &^ words[w]
+			for added != 0 {
+				bit := int64(bits.TrailingZeros64(added))
+				added &= added - 1
+
+				sum := int64(w)*64 + bit
+				if sum > limit {
+					continue
+				}
+				words[w] |= 1 << bit
+				from[sum] = int32(i)
+
+				if sum >= needed && (best == -1 || sum < best) {
+					best = sum
+				}
+			}
+		}
+
+		if best == needed {
+			break
+		}
+	}
+
+	chosen := make(map[string]bool)
+	for sum := best; sum > 0; {
+		f := files[from[sum]]
+		chosen[f.path] = true
+		sum -= f.size
+	}
+
+	return compactDeletion(candidates, chosen), nil
+}
+
+// searchFewestBytes finds the files freeing the fewest bytes that still free
+// at least needed by trying the largest files first, pruning any branch that
+// can't reach needed or can't beat the best set found so far. It gives up
+// with an error rather than run for too long.
+func searchFewestBytes(
+	files []deletionCandidate,
+	needed int64,
+) (map[string]bool, error) {
+	sorted := append([]deletionCandidate{}, files...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].size > sorted[j].size
+	})
+
+	// remaining[i] is how much the files from i onwards free between them.
+	remaining := make([]int64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].size
+	}
+
+	best := remaining[0]
+	bestSet := make([]int, len(sorted))
+	for i := range bestSet {
+		bestSet[i] = i
+	}
+
+	set := []int{}
+	nodes := 0
+	var search func(i int, sum int64)
+	search = func(i int, sum int64) {
+		nodes++
+		if nodes > maxSearchNodes || best == needed {
+			return
+		}
+		if sum >= needed {
+			if sum < best {
+				best = sum
+				bestSet = append(bestSet[:0], set...)
+			}
+			return
+		}
+		if i == len(sorted) || sum+remaining[i] < needed {
+			return
+		}
+
+		if sum+sorted[i].size < best {
+			set = append(set, i)
+			search(i+1, sum+sorted[i].size)
+			set = set[:len(set)-1]
+		}
+		search(i+1, sum)
+	}
+	search(0, 0)
+
+	if nodes > maxSearchNodes {
+		return nil, fmt.Errorf(
+			"too many files to find the fewest bytes to delete, "+
+				"gave up after %d steps; try -goal items",
+			maxSearchNodes,
+		)
+	}
+
+	chosen := make(map[string]bool)
+	for _, i := range bestSet {
+		chosen[sorted[i].path] = true
+	}
+	return chosen, nil
+}
+
+// compactDeletion replaces the chosen files of any directory whose files
+// were all chosen with the directory itself.
+func compactDeletion(
+	candidates []deletionCandidate,
+	chosen map[string]bool,
+) []deletionCandidate {
+	items := []deletionCandidate{}
+
+	for _, c := range candidates {
+		covered := false
+		for _, item := range items {
+			if item.isDir && isWithin(c.path, item.path) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+
+		if !c.isDir {
+			if chosen[c.path] {
+				items = append(items, c)
+			}
+			continue
+		}
+
+		complete, found := true, false
+		for _, f := range candidates {
+			if f.isDir || f.size == 0 || !isWithin(f.path, c.path) {
+				continue
+			}
+			if !chosen[f.path] {
+				complete = false
+				break
+			}
+			found = true
+		}
+		if complete && found {
+			items = append(items, c)
+		}
+	}
+
+	return items
+}
+
+// planFewestItems solves the fewest-items goal by trying ever larger plans,
+// searching for the one with the fewest bytes among plans of the smallest
+// size that frees enough space.
+func planFewestItems(
+	candidates []deletionCandidate,
+	needed int64,
+) ([]deletionCandidate, error) {
+	items := []deletionCandidate{}
+	for _, c := range candidates {
+		if c.size > 0 {
+			items = append(items, c)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].size > items[j].size
+	})
+
+	var best []deletionCandidate
+	var bestSize int64
+	chosen := []deletionCandidate{}
+
+	var search func(start, picks int, freed int64)
+	search = func(start, picks int, freed int64) {
+		if best != nil && freed >= bestSize {
+			return
+		}
+		if picks == 0 {
+			if freed >= needed {
+				best = append([]deletionCandidate{}, chosen...)
+				bestSize = freed
+			}
+			return
+		}
+
+		var bound int64
+		for i := start; i < len(items) && i < start+picks; i++ {
+			bound += items[i].size
+		}
+		if freed+bound < needed {
+			return
+		}
+
+		for i := start; i < len(items); i++ {
+			nested := false
+			for _, c := range chosen {
+				if isWithin(items[i].path, c.path) || isWithin(c.path, items[i].path) {
+					nested = true
+					break
+				}
+			}
+			if nested {
+				continue
+			}
+
+			chosen = append(chosen, items[i])
+			search(i+1, picks-1, freed+items[i].size)
+			chosen = chosen[:len(chosen)-1]
+		}
+	}
+
+	for picks := 1; picks <= len(items) && best == nil; picks++ {
+		search(0, picks, 0)
+	}
+	if best == nil {
+		return nil, fmt.Errorf("not enough deletable space to free %d bytes", needed)
+	}
+
+	sort.Slice(best, func(i, j int) bool {
+		return best[i].path < best[j].path
+	})
+	return best, nil
+}
+
+func (p deletionPlan) write(w io.Writer, diskSpace, used int64, human bool) {
+	fmt.Fprintf(
+		w,
+		"Deletion plan (fewest %s) to free %s:\n",
+		p.goal, formatSize(p.needed, human),
+	)
+	for _, item := range p.items {
+		kind := "file"
+		if item.isDir {
+			kind = "dir"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", formatSize(item.size, human), kind, item.path)
+	}
+	fmt.Fprintf(
+		w,
+		"Deleting %d items frees %s\n",
+		len(p.items), formatSize(p.freed, human),
+	)
+
+	fmt.Fprintf(w, "%-8s %12s %12s %12s\n", "", "size", "used", "free")
+	fmt.Fprintf(
+		w,
+		"%-8s %12s %12s %12s\n",
+		"before",
+		formatSize(diskSpace, human),
+		formatSize(used, human),
+		formatSize(diskSpace-used, human),
+	)
+	fmt.Fprintf(
+		w,
+		"%-8s %12s %12s %12s\n",
+		"after",
+		formatSize(diskSpace, human),
+		formatSize(used-p.freed, human),
+		formatSize(diskSpace-used+p.freed, human),
+	)
+}
+
+const (
+	entryTypeDir  = "dir"
+	entryTypeFile = "file"
+)
+
+// jsonEntry is the JSON form of a file or directory. The size of a directory
+// is its total size, which is checked against its contents on import.
+type jsonEntry struct {
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	Size     int64        `json:"size"`
+	Children []*jsonEntry `json:"children,omitempty"`
+}
+
+func newJSONEntry(name string, entity diskEntity) *jsonEntry {
+	dir, ok := entity.(*directory)
+	if !ok {
+		return &jsonEntry{Name: name, Type: entryTypeFile, Size: entity.Size()}
+	}
+
+	entry := &jsonEntry{
+		Name:     name,
+		Type:     entryTypeDir,
+		Size:     dir.Size(),
+		Children: []*jsonEntry{},
+	}
+	for _, child := range dir.sortedNames() {
+		entry.Children = append(entry.Children, newJSONEntry(child, dir.children[child]))
+	}
+
+	return entry
+}
+
+func (fs fileSystem) exportJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newJSONEntry(fs.root.name, fs.root))
+}
+
+func checkEntryName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	return nil
+}
+
+// importEntries adds the children of a JSON directory to the current
+// directory, returning the total size of the files added.
+func (fs *fileSystem) importEntries(p string, entry *jsonEntry) (int64, error) {
+	var total int64 = 0
+
+	for _, child := range entry.Children {
+		childPath := path.Join(p, child.Name)
+		if err := checkEntryName(child.Name); err != nil {
+			return 0, fmt.Errorf("%s: %w", p, err)
+		}
+		if _, exists := fs.cwd.children[child.Name]; exists {
+			return 0, fmt.Errorf("%s: listed more than once", childPath)
+		}
+
+		switch child.Type {
+		case entryTypeFile:
+			if len(child.Children) > 0 {
+				return 0, fmt.Errorf("%s: file has children", childPath)
+			}
+			if child.Size < 0 {
+				return 0, fmt.Errorf("%s: negative size %d", childPath, child.Size)
+			}
+			if err := fs.addFile(child.Size, child.Name); err != nil {
+				return 0, fmt.Errorf("%s: %w", childPath, err)
+			}
+			total += child.Size
+		case entryTypeDir:
+			if err := fs.cd(child.Name); err != nil {
+				return 0, fmt.Errorf("%s: %w", childPath, err)
+			}
+			size, err := fs.importEntries(childPath, child)
+			if err != nil {
+				return 0, err
+			}
+			if err := fs.cd(".."); err != nil {
+				return 0, err
+			}
+			total += size
+		default:
+			return 0, fmt.Errorf("%s: unknown type %q", childPath, child.Type)
+		}
+	}
+
+	if entry.Size != total {
+		return 0, fmt.Errorf(
+			"%s: directory size %d does not match its contents of %d",
+			p, entry.Size, total,
+		)
+	}
+
+	return total, nil
+}
+
+func importJSON(r io.Reader) (*fileSystem, error) {
+	var root jsonEntry
+	if err := json.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	if root.Type != entryTypeDir {
+		return nil, fmt.Errorf("root entry has type %q, expected dir", root.Type)
+	}
+
+	fs := newRootFileSystem()
+	if _, err := fs.importEntries("/", &root); err != nil {
+		return nil, err
+	}
+
+	fs.cwd = fs.root
+	return fs, nil
+}
+
+// materialise recreates the filesystem as real directories under dest, with
+// every file a sparse file of the right size. dest must be empty or not yet
+// exist.
+func (fs fileSystem) materialise(dest string) error {
+	if entries, err := os.ReadDir(dest); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s: directory is not empty", dest)
+	}
+
+	var create func(p string, dir *directory) error
+	create = func(p string, dir *directory) error {
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			return err
+		}
+
+		for _, name := range dir.sortedNames() {
+			if err := checkEntryName(name); err != nil {
+				return err
+			}
+
+			childPath := filepath.Join(p, name)
+			if childDir, ok := dir.children[name].(*directory); ok {
+				if err := create(childPath, childDir); err != nil {
+					return err
+				}
+				continue
+			}
+
+			f, err := os.Create(childPath)
+			if err != nil {
+				return err
+			}
+			err = f.Truncate(dir.children[name].Size())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return create(dest, fs.root)
+}
+
 func main() {
-	bytes, err := os.ReadFile("input.txt")
+	interactive := flag.Bool(
+		"shell",
+		false,
+		"explore the filesystem with commands read from stdin",
+	)
+	showTree := flag.Bool("tree", false, "print the filesystem as a tree")
+	showDu := flag.Bool("du", false, "list the total size of every directory")
+	opts := reportOptions{}
+	flag.IntVar(&opts.maxDepth, "depth", -1, "maximum depth of the tree or du report")
+	flag.StringVar(&opts.sortBy, "sort", sortByName, "sort reports by name or size")
+	flag.BoolVar(&opts.human, "human", false, "print human-readable sizes in reports")
+	maxSize := flag.Int64(
+		"max-size",
+		defaultMaxSize,
+		"sum the sizes of directories no bigger than this",
+	)
+	diskSpace := flag.Int64("disk-size", defaultTotalDiskSpace, "total disk space")
+	requiredSpace := flag.Int64(
+		"required-space",
+		defaultRequiredDiskSpace,
+		"free space needed on the disk",
+	)
+	largest := flag.Int("largest", 0, "list the `k` largest directories")
+	plan := flag.Bool(
+		"plan",
+		false,
+		"plan which files and directories to delete to free the required space",
+	)
+	goal := flag.String(
+		"goal",
+		goalFewestBytes,
+		"deletion plan goal: fewest bytes or fewest items",
+	)
+	protect := flag.String(
+		"protect",
+		"",
+		"comma-separated list of paths the deletion plan must keep",
+	)
+	importFile := flag.String(
+		"import-json",
+		"",
+		"read the filesystem from a JSON `file` instead of the transcript",
+	)
+	exportFile := flag.String(
+		"export-json",
+		"",
+		"write the filesystem as JSON to `file`, or - for stdout",
+	)
+	materialiseDir := flag.String(
+		"materialise",
+		"",
+		"recreate the filesystem as sparse files under `dir`",
+	)
+	flag.Parse()
+
+	if err := opts.validate(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	fs, err := loadFileSystem(*importFile)
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
 
-	input := strings.TrimSpace(string(bytes))
-	fs := mapFileSystem(input)
+	if *exportFile != "" || *materialiseDir != "" {
+		if err := export(fs, *exportFile, *materialiseDir); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *interactive {
+		sh := newShell(fs, os.Stdout)
+		if err := sh.run(os.Stdin); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *plan {
+		protected := []string{}
+		for _, p := range strings.Split(*protect, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protected = append(protected, p)
+			}
+		}
+
+		used := fs.root.Size()
+		needed := *requiredSpace - (*diskSpace - used)
+		deletion, err := fs.planDeletion(needed, *goal, protected)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		deletion.write(os.Stdout, *diskSpace, used, opts.human)
+		return
+	}
+
+	if *showTree || *showDu {
+		if *showTree {
+			writeTree(os.Stdout, "/", fs.root, opts)
+		}
+		if *showDu {
+			writeDu(os.Stdout, "/", fs.root, opts)
+		}
+		return
+	}
 
-	log.Println("Total size of directories < 100000:", fs.getSizeSum())
+	log.Printf(
+		"Total size of directories <= %d: %d\n",
+		*maxSize,
+		fs.getSizeSum(*maxSize),
+	)
 	log.Println(
 		"Size of the smallest eligible directoy to delete:",
-		fs.getSmallestEligibleDirectory(),
+		fs.getSmallestEligibleDirectory(*diskSpace, *requiredSpace),
 	)
+
+	if *largest > 0 {
+		log.Printf("The %d largest directories are:\n", *largest)
+		for _, dir := range fs.root.largestDirs(*largest) {
+			log.Printf("%d\t%s\n", dir.Size(), dir.path())
+		}
+	}
+}
+
+func loadFileSystem(importFile string) (*fileSystem, error) {
+	if importFile != "" {
+		f, err := os.Open(importFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		fs, err := importJSON(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", importFile, err)
+		}
+		return fs, nil
+	}
+
+	bytes, err := os.ReadFile("input.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	input := strings.TrimSpace(string(bytes))
+	return mapFileSystem(input)
 }
 
-func mapFileSystem(input string) *fileSystem {
+func export(fs *fileSystem, exportFile, materialiseDir string) error {
+	if exportFile == "-" {
+		if err := fs.exportJSON(os.Stdout); err != nil {
+			return err
+		}
+	} else if exportFile != "" {
+		f, err := os.Create(exportFile)
+		if err != nil {
+			return err
+		}
+		err = fs.exportJSON(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if materialiseDir != "" {
+		if err := fs.materialise(materialiseDir); err != nil {
+			return err
+		}
+		log.Println("Materialised the filesystem under", materialiseDir)
+	}
+
+	return nil
+}
+
+// mapFileSystem rebuilds a filesystem from a terminal transcript, one line
+// at a time. Lines starting with "$ " are commands and every other line is
+// output from the last command, which must be ls.
+func mapFileSystem(input string) (*fileSystem, error) {
 	fs := newRootFileSystem()
+	listing := false
+
+	for i, line := range strings.Split(input, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var err error
+		if cmdLine, ok := strings.CutPrefix(line, "$ "); ok {
+			listing = false
 
-	commands := strings.Split(input, "$")
-	for _, cmd := range commands {
-		cmd = strings.TrimSpace(cmd)
-		lines := strings.Split(cmd, "\n")
+			args := strings.Fields(cmdLine)
+			switch {
+			case len(args) == 0:
+				err = errors.New("empty command")
+			case args[0] == "cd" && len(args) == 2:
+				err = fs.cd(args[1])
+			case args[0] == "cd":
+				err = fmt.Errorf("cd takes 1 argument, got %d", len(args)-1)
+			case args[0] == "ls" && len(args) == 1:
+				listing = true
+			case args[0] == "ls":
+				err = errors.New("ls takes no arguments")
+			default:
+				err = fmt.Errorf("unknown command %q", args[0])
+			}
+		} else if listing {
+			err = fs.ls(line)
+		} else {
+			err = fmt.Errorf("unexpected output %q outside of ls", line)
+		}
 
-		cmdLine := strings.TrimSpace(lines[0])
-		args := strings.Split(cmdLine, " ")
-		switch args[0] {
-		case "cd":
-			fs.cd(args[1])
-		case "ls":
-			fs.ls(lines[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
 		}
 	}
 
-	return fs
+	fs.cwd = fs.root
+	return fs, nil
+}
+
+func formatSize(size int64, human bool) string {
+	if !human {
+		return strconv.FormatInt(size, 10)
+	}
+
+	const units = "KMGTPE"
+	if size < 1024 {
+		return strconv.FormatInt(size, 10)
+	}
+
+	value := float64(size)
+	unit := -1
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if value < 10 {
+		return fmt.Sprintf("%.1f%c", value, units[unit])
+	}
+	return fmt.Sprintf("%.0f%c", value, units[unit])
+}
+
+// parseSize reads a size such as 100000, 100k or 2M, where the suffixes are
+// powers of 1024 as with du -h.
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size * multiplier, nil
+}
+
+const (
+	sortByName = "name"
+	sortBySize = "size"
+)
+
+type reportOptions struct {
+	maxDepth int
+	sortBy   string
+	human    bool
+}
+
+func (o reportOptions) validate() error {
+	if o.sortBy != sortByName && o.sortBy != sortBySize {
+		return fmt.Errorf("unknown sort order %q", o.sortBy)
+	}
+	return nil
+}
+
+func (o reportOptions) withinDepth(depth int) bool {
+	return o.maxDepth < 0 || depth <= o.maxDepth
+}
+
+// sortedChildren lists the names of a directory's children, largest first
+// when sorting by size and alphabetically otherwise.
+func (o reportOptions) sortedChildren(d *directory) []string {
+	names := d.sortedNames()
+	if o.sortBy == sortBySize {
+		sort.SliceStable(names, func(i, j int) bool {
+			return d.children[names[i]].Size() > d.children[names[j]].Size()
+		})
+	}
+	return names
+}
+
+// writeTree draws an entity and everything below it as an indented tree,
+// showing the size of every file and the total size of every directory.
+func writeTree(w io.Writer, name string, entity diskEntity, opts reportOptions) {
+	var walk func(name string, entity diskEntity, depth int)
+	walk = func(name string, entity diskEntity, depth int) {
+		indent := strings.Repeat("  ", depth)
+		size := formatSize(entity.Size(), opts.human)
+
+		dir, ok := entity.(*directory)
+		if !ok {
+			fmt.Fprintf(w, "%s- %s (file, size=%s)\n", indent, name, size)
+			return
+		}
+
+		fmt.Fprintf(w, "%s- %s (dir, size=%s)\n", indent, name, size)
+		if !opts.withinDepth(depth + 1) {
+			return
+		}
+		for _, child := range opts.sortedChildren(dir) {
+			walk(child, dir.children[child], depth+1)
+		}
+	}
+
+	walk(name, entity, 0)
+}
+
+type duEntry struct {
+	path string
+	size int64
+}
+
+// writeDu lists the total size of a directory and every directory below it,
+// sorted by path or from largest to smallest.
+func writeDu(w io.Writer, root string, dir *directory, opts reportOptions) {
+	entries := []duEntry{}
+
+	var walk func(p string, dir *directory, depth int)
+	walk = func(p string, dir *directory, depth int) {
+		entries = append(entries, duEntry{path: p, size: dir.Size()})
+		if !opts.withinDepth(depth + 1) {
+			return
+		}
+		for name, child := range dir.children {
+			if childDir, ok := child.(*directory); ok {
+				walk(path.Join(p, name), childDir, depth+1)
+			}
+		}
+	}
+	walk(root, dir, 0)
+
+	sort.Slice(entries, func(i, j int) bool {
+		if opts.sortBy == sortBySize && entries[i].size != entries[j].size {
+			return entries[i].size > entries[j].size
+		}
+		return entries[i].path < entries[j].path
+	})
+
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\n", formatSize(e.size, opts.human), e.path)
+	}
+}
+
+// shell is an interactive session over a reconstructed filesystem.
+type shell struct {
+	fs  *fileSystem
+	out io.Writer
+}
+
+func newShell(fs *fileSystem, out io.Writer) *shell {
+	return &shell{fs: fs, out: out}
+}
+
+func (sh *shell) run(input io.Reader) error {
+	scanner := bufio.NewScanner(input)
+
+	fmt.Fprint(sh.out, "$ ")
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		if len(args) > 0 {
+			if args[0] == "exit" || args[0] == "quit" {
+				return nil
+			}
+			if err := sh.execute(args[0], args[1:]); err != nil {
+				fmt.Fprintf(sh.out, "%s: %v\n", args[0], err)
+			}
+		}
+		fmt.Fprint(sh.out, "$ ")
+	}
+	fmt.Fprintln(sh.out)
+
+	return scanner.Err()
+}
+
+func (sh *shell) execute(cmd string, args []string) error {
+	switch cmd {
+	case "cd":
+		target := "/"
+		if len(args) > 0 {
+			target = args[0]
+		}
+		return sh.fs.changeDir(target)
+	case "pwd":
+		fmt.Fprintln(sh.out, sh.fs.cwd.path())
+		return nil
+	case "ls":
+		return sh.ls(args)
+	case "tree":
+		return sh.tree(args)
+	case "du":
+		return sh.du(args)
+	case "find":
+		return sh.find(args)
+	case "stat":
+		return sh.stat(args)
+	case "help":
+		fmt.Fprintln(
+			sh.out,
+			"commands: cd, ls, pwd, tree [-d N] [-s name|size] [-h], "+
+				"du [-d N] [-s name|size] [-h], find [-size [+-]N], stat, exit",
+		)
+		return nil
+	default:
+		return errors.New("command not found")
+	}
+}
+
+// target resolves the single optional path argument of a command, defaulting
+// to the current directory.
+func (sh *shell) target(args []string) (diskEntity, string, error) {
+	if len(args) > 1 {
+		return nil, "", errors.New("too many arguments")
+	}
+	if len(args) == 0 {
+		return sh.fs.resolve(".")
+	}
+	return sh.fs.resolve(args[0])
+}
+
+func (sh *shell) ls(args []string) error {
+	entity, p, err := sh.target(args)
+	if err != nil {
+		return err
+	}
+
+	dir, ok := entity.(*directory)
+	if !ok {
+		fmt.Fprintln(sh.out, entity.Size(), path.Base(p))
+		return nil
+	}
+
+	for _, name := range dir.sortedNames() {
+		switch child := dir.children[name].(type) {
+		case *directory:
+			fmt.Fprintln(sh.out, "dir", name)
+		default:
+			fmt.Fprintln(sh.out, child.Size(), name)
+		}
+	}
+	return nil
+}
+
+// reportOptions parses the options shared by the tree and du commands,
+// returning the remaining arguments.
+func (sh *shell) reportOptions(
+	cmd string,
+	args []string,
+) (reportOptions, []string, error) {
+	opts := reportOptions{maxDepth: -1, sortBy: sortByName}
+
+	flags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	flags.SetOutput(sh.out)
+	flags.IntVar(&opts.maxDepth, "d", opts.maxDepth, "maximum depth to show")
+	flags.StringVar(&opts.sortBy, "s", opts.sortBy, "sort by name or size")
+	flags.BoolVar(&opts.human, "h", false, "human-readable sizes")
+
+	if err := flags.Parse(args); err != nil {
+		return opts, nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return opts, nil, err
+	}
+
+	return opts, flags.Args(), nil
+}
+
+func (sh *shell) tree(args []string) error {
+	opts, args, err := sh.reportOptions("tree", args)
+	if err != nil {
+		return err
+	}
+
+	entity, p, err := sh.target(args)
+	if err != nil {
+		return err
+	}
+
+	writeTree(sh.out, p, entity, opts)
+	return nil
+}
+
+func (sh *shell) du(args []string) error {
+	opts, args, err := sh.reportOptions("du", args)
+	if err != nil {
+		return err
+	}
+
+	entity, p, err := sh.target(args)
+	if err != nil {
+		return err
+	}
+
+	dir, ok := entity.(*directory)
+	if !ok {
+		fmt.Fprintf(sh.out, "%s\t%s\n", formatSize(entity.Size(), opts.human), p)
+		return nil
+	}
+
+	writeDu(sh.out, p, dir, opts)
+	return nil
+}
+
+func (sh *shell) find(args []string) error {
+	start := "."
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		start, args = args[0], args[1:]
+	}
+
+	match := func(size int64) bool {
+		return true
+	}
+	if len(args) > 0 {
+		if len(args) != 2 || args[0] != "-size" {
+			return errors.New("usage: find [path] [-size [+-]N]")
+		}
+
+		sign, value := byte(0), args[1]
+		if value != "" && (value[0] == '+' || value[0] == '-') {
+			sign, value = value[0], value[1:]
+		}
+
+		limit, err := parseSize(value)
+		if err != nil {
+			return err
+		}
+
+		match = func(size int64) bool {
+			switch sign {
+			case '+':
+				return size > limit
+			case '-':
+				return size < limit
+			default:
+				return size == limit
+			}
+		}
+	}
+
+	entity, p, err := sh.fs.resolve(start)
+	if err != nil {
+		return err
+	}
+
+	var walk func(p string, entity diskEntity)
+	walk = func(p string, entity diskEntity) {
+		dir, ok := entity.(*directory)
+		if !ok {
+			if match(entity.Size()) {
+				fmt.Fprintln(sh.out, p)
+			}
+			return
+		}
+
+		for _, name := range dir.sortedNames() {
+			walk(path.Join(p, name), dir.children[name])
+		}
+	}
+
+	walk(p, entity)
+	return nil
+}
+
+func (sh *shell) stat(args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing operand")
+	}
+
+	for _, arg := range args {
+		entity, p, err := sh.fs.resolve(arg)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(sh.out, "  Path:", p)
+		if dir, ok := entity.(*directory); ok {
+			fmt.Fprintln(sh.out, "  Type: directory")
+			fmt.Fprintln(sh.out, "  Size:", dir.Size())
+			fmt.Fprintln(sh.out, "  Entries:", len(dir.children))
+		} else {
+			fmt.Fprintln(sh.out, "  Type: file")
+			fmt.Fprintln(sh.out, "  Size:", entity.Size())
+		}
+	}
+	return nil
 }
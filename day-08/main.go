@@ -2,14 +2,22 @@ package main
 
 import (
 	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"log"
+	"math"
+	"math/bits"
 	"os"
+	"path/filepath"
 	"strconv"
-)
-
-const (
-	minHeight = 0
-	maxHeight = 9
+	"strings"
+	"unicode"
 )
 
 type coord struct {
@@ -20,77 +28,286 @@ type treeFarm struct {
 	trees [][]int
 }
 
-func (f *treeFarm) parseTrees(file *os.File) {
-	fileScanner := bufio.NewScanner(file)
+func isHeightSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// parseRow reads one row of tree heights. Rows containing commas or spaces
+// hold separated integers of any size, while any other row holds one
+// single-digit height per character.
+func parseRow(line string) ([]int, error) {
+	if strings.IndexFunc(line, isHeightSeparator) == -1 {
+		row := make([]int, len(line))
+		for j, c := range line {
+			if c < '0' || c > '9' {
+				return nil, fmt.Errorf("invalid height %q at column %d", c, j+1)
+			}
+			row[j] = int(c - '0')
+		}
+		return row, nil
+	}
+
+	fields := strings.FieldsFunc(line, isHeightSeparator)
+	row := make([]int, len(fields))
+	for j, field := range fields {
+		height, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid height %q in column %d", field, j+1)
+		}
+		row[j] = height
+	}
+	return row, nil
+}
+
+func (f *treeFarm) parseTrees(r io.Reader) error {
+	fileScanner := bufio.NewScanner(r)
 	fileScanner.Split(bufio.ScanLines)
 
-	i := 0
-	for fileScanner.Scan() {
-		row := fileScanner.Text()
-		f.trees = append(f.trees, make([]int, len(row)))
-		for j := range row {
-			f.trees[i][j], _ = strconv.Atoi(string(row[j]))
+	for i := 1; fileScanner.Scan(); i++ {
+		line := strings.TrimSpace(fileScanner.Text())
+		if line == "" {
+			continue
+		}
 
+		row, err := parseRow(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i, err)
+		}
+		if len(f.trees) > 0 && len(row) != f.width() {
+			return fmt.Errorf(
+				"line %d: row has %d trees, expected %d",
+				i, len(row), f.width(),
+			)
 		}
 
-		i++
+		f.trees = append(f.trees, row)
 	}
+	if err := fileScanner.Err(); err != nil {
+		return err
+	}
+
+	if len(f.trees) == 0 || f.width() == 0 {
+		return errors.New("no trees found")
+	}
+	return nil
 }
 
-func (f treeFarm) findVisibleTrees() int {
-	visible := make(map[coord]bool)
+func (f treeFarm) width() int {
+	if len(f.trees) == 0 {
+		return 0
+	}
+	return len(f.trees[0])
+}
 
-	for h := minHeight; h <= maxHeight; h++ {
-		for i, row := range f.trees {
-			for j, height := range row {
-				if height == h {
-					visible[coord{x: j, y: i}] = true
-				}
-				if height >= h {
-					break
-				}
+func (f treeFarm) height() int {
+	return len(f.trees)
+}
+
+func (f treeFarm) heightRange() (int, int) {
+	if f.width() == 0 {
+		return 0, -1
+	}
+
+	lowest, highest := f.trees[0][0], f.trees[0][0]
+	for _, row := range f.trees {
+		for _, h := range row {
+			lowest = min(lowest, h)
+			highest = max(highest, h)
+		}
+	}
+	return lowest, highest
+}
+
+type sightBlocker struct {
+	pos, height int
+}
+
+// sightLine is a monotonic stack of the trees along a line of sight that
+// could still block the view of a tree further along it. Heights strictly
+// decrease towards the top of the stack, as a tree hides every earlier tree
+// that is no taller from anything further along, and each tree is pushed and
+// popped at most once.
+type sightLine []sightBlocker
+
+// look adds the tree at pos to the line, returning the updated line and the
+// position of the nearest earlier tree at least as tall, if there is one.
+func (l sightLine) look(pos, height int) (sightLine, int, bool) {
+	top := len(l)
+	for top > 0 && l[top-1].height < height {
+		top--
+	}
+	if top == 0 {
+		return append(l[:0], sightBlocker{pos: pos, height: height}), 0, false
+	}
+
+	blocker := l[top-1]
+	if blocker.height == height {
+		top--
+	}
+	return append(l[:top], sightBlocker{pos: pos, height: height}), blocker.pos, true
+}
+
+// newGrid allocates a rows by cols grid backed by a single slice.
+func newGrid[T any](rows, cols int) [][]T {
+	cells := make([]T, rows*cols)
+	grid := make([][]T, rows)
+	for y := range grid {
+		grid[y] = cells[y*cols : (y+1)*cols]
+	}
+	return grid
+}
+
+// treeSet is a bitset of the trees in a farm. It is an eighth of the size of
+// a grid of bools, so clearing it costs little next to the short walks in
+// from the edges that usually find every visible tree.
+type treeSet struct {
+	cols  int
+	words []uint64
+}
+
+func newTreeSet(rows, cols int) treeSet {
+	return treeSet{cols: cols, words: make([]uint64, (rows*cols+63)/64)}
+}
+
+func (s treeSet) add(x, y int) {
+	i := y*s.cols + x
+	s.words[i/64] |= 1 << (i % 64)
+}
+
+func (s treeSet) has(x, y int) bool {
+	i := y*s.cols + x
+	return s.words[i/64]&(1<<(i%64)) != 0
+}
+
+func (s treeSet) len() int {
+	total := 0
+	for _, w := range s.words {
+		total += bits.OnesCount64(w)
+	}
+	return total
+}
+
+// surveyVisibility marks the trees that are visible from outside the farm.
+// Looking in from an edge, a tree is visible if it is taller than every tree
+// before it, and nothing can be seen past the tallest height in the farm, so
+// each line of sight stops as soon as it reaches a tree of that height.
+func (f treeFarm) surveyVisibility() treeSet {
+	rows, cols := f.height(), f.width()
+	visible := newTreeSet(rows, cols)
+	_, tallest := f.heightRange()
+
+	for y, row := range f.trees {
+		highest := math.MinInt
+		for x := 0; x < cols && highest < tallest; x++ {
+			if row[x] > highest {
+				visible.add(x, y)
+				highest = row[x]
 			}
-			for j := len(row) - 1; j >= 0; j-- {
-				height := row[j]
-				if height == h {
-					visible[coord{x: j, y: i}] = true
-				}
-				if height >= h {
-					break
-				}
+		}
+
+		highest = math.MinInt
+		for x := cols - 1; x >= 0 && highest < tallest; x-- {
+			if row[x] > highest {
+				visible.add(x, y)
+				highest = row[x]
 			}
 		}
-		for i := 0; i < len(f.trees[0]); i++ {
-			for j := 0; j < len(f.trees); j++ {
-				height := f.trees[j][i]
-				if height == h {
-					visible[coord{x: i, y: j}] = true
-				}
-				if height >= h {
-					break
-				}
+	}
+
+	for x := 0; x < cols; x++ {
+		highest := math.MinInt
+		for y := 0; y < rows && highest < tallest; y++ {
+			if h := f.trees[y][x]; h > highest {
+				visible.add(x, y)
+				highest = h
 			}
-			for j := len(f.trees) - 1; j >= 0; j-- {
-				height := f.trees[j][i]
-				if height == h {
-					visible[coord{x: i, y: j}] = true
-				}
-				if height >= h {
-					break
-				}
+		}
+
+		highest = math.MinInt
+		for y := rows - 1; y >= 0 && highest < tallest; y-- {
+			if h := f.trees[y][x]; h > highest {
+				visible.add(x, y)
+				highest = h
+			}
+		}
+	}
+
+	return visible
+}
+
+// surveyScenicScores finds the scenic score of every tree in O(rows×cols)
+// time by looking along every row and column in both directions. Columns are
+// swept a row at a time with a stack per column so the farm is always read in
+// row order.
+func (f treeFarm) surveyScenicScores() [][]int {
+	rows, cols := f.height(), f.width()
+	scores := newGrid[int](rows, cols)
+
+	var blocker int
+	var blocked bool
+
+	line := make(sightLine, 0, cols)
+	for y, row := range f.trees {
+		line = line[:0]
+		for x, h := range row {
+			line, blocker, blocked = line.look(x, h)
+			if blocked {
+				scores[y][x] = x - blocker
+			} else {
+				scores[y][x] = x
+			}
+		}
+
+		line = line[:0]
+		for x := cols - 1; x >= 0; x-- {
+			line, blocker, blocked = line.look(x, row[x])
+			if blocked {
+				scores[y][x] *= blocker - x
+			} else {
+				scores[y][x] *= cols - 1 - x
+			}
+		}
+	}
+
+	columns := make([]sightLine, cols)
+	for y := 0; y < rows; y++ {
+		for x, h := range f.trees[y] {
+			columns[x], blocker, blocked = columns[x].look(y, h)
+			if blocked {
+				scores[y][x] *= y - blocker
+			} else {
+				scores[y][x] *= y
+			}
+		}
+	}
+
+	for x := range columns {
+		columns[x] = columns[x][:0]
+	}
+	for y := rows - 1; y >= 0; y-- {
+		for x, h := range f.trees[y] {
+			columns[x], blocker, blocked = columns[x].look(y, h)
+			if blocked {
+				scores[y][x] *= blocker - y
+			} else {
+				scores[y][x] *= rows - 1 - y
 			}
 		}
 	}
 
-	return len(visible)
+	return scores
+}
+
+func (f treeFarm) findVisibleTrees() int {
+	return f.surveyVisibility().len()
 }
 
 func (f treeFarm) findMostScenicScore() int {
-	max := 0
+	scores := f.surveyScenicScores()
 
-	for i, row := range f.trees {
-		for j, height := range row {
-			score := f.getTreeScenicScore(j, i, height)
+	max := 0
+	for _, row := range scores {
+		for _, score := range row {
 			if score > max {
 				max = score
 			}
@@ -100,44 +317,146 @@ func (f treeFarm) findMostScenicScore() int {
 	return max
 }
 
-func (f treeFarm) getTreeScenicScore(x, y, treeHeight int) int {
-	leftScore := 0
-	for i := x - 1; i >= 0; i-- {
-		currHeight := f.trees[y][i]
-		leftScore++
-		if currHeight >= treeHeight {
-			break
-		}
+var (
+	axisDirections = []coord{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	allDirections  = []coord{
+		{-1, 0}, {1, 0}, {0, -1}, {0, 1},
+		{-1, -1}, {1, -1}, {-1, 1}, {1, 1},
 	}
+)
+
+func (f treeFarm) inFarm(c coord) bool {
+	return c.y >= 0 && c.y < f.height() && c.x >= 0 && c.x < f.width()
+}
 
-	rightScore := 0
-	for i := x + 1; i < len(f.trees[y]); i++ {
-		currHeight := f.trees[y][i]
-		rightScore++
-		if currHeight >= treeHeight {
+// lookAlong walks out from an observer with their eye at the given height,
+// stepping by dir each time, and returns how many trees they can see: every
+// tree up to and including the first one at least as tall as the eye. seen,
+// if not nil, is called with each tree seen. The observer may stand outside
+// the farm, in which case the walk starts once the line enters the farm.
+func (f treeFarm) lookAlong(from, dir coord, height int, seen func(c coord)) int {
+	if dir == (coord{}) {
+		return 0
+	}
+
+	// Beyond this many steps the line can no longer be inside the farm.
+	limit := abs(from.x) + abs(from.y) + f.width() + f.height()
+
+	count, entered := 0, false
+	pos := from
+	for step := 0; step < limit; step++ {
+		pos.x += dir.x
+		pos.y += dir.y
+		if !f.inFarm(pos) {
+			if entered {
+				break
+			}
+			continue
+		}
+		entered = true
+
+		count++
+		if seen != nil {
+			seen(pos)
+		}
+		if f.trees[pos.y][pos.x] >= height {
 			break
 		}
 	}
 
-	topScore := 0
-	for i := y - 1; i >= 0; i-- {
-		currHeight := f.trees[i][x]
-		topScore++
-		if currHeight >= treeHeight {
-			break
+	return count
+}
+
+// lineOfSight lists every tree an observer can see along each direction.
+func (f treeFarm) lineOfSight(from coord, height int, dirs []coord) []coord {
+	visible := []coord{}
+	for _, dir := range dirs {
+		f.lookAlong(from, dir, height, func(c coord) {
+			visible = append(visible, c)
+		})
+	}
+	return visible
+}
+
+// seenBy lists every tree that can see the target tree when looking along
+// one of the directions. A tree sees the target if every tree in between is
+// shorter than it.
+func (f treeFarm) seenBy(target coord, dirs []coord) []coord {
+	watchers := []coord{}
+	if !f.inFarm(target) {
+		return watchers
+	}
+
+	for _, dir := range dirs {
+		if dir == (coord{}) {
+			continue
+		}
+
+		tallest := math.MinInt
+		pos := target
+		for {
+			pos.x -= dir.x
+			pos.y -= dir.y
+			if !f.inFarm(pos) {
+				break
+			}
+
+			height := f.trees[pos.y][pos.x]
+			if tallest < height {
+				watchers = append(watchers, pos)
+			}
+			tallest = max(tallest, height)
 		}
 	}
 
-	bottomScore := 0
-	for i := y + 1; i < len(f.trees); i++ {
-		currHeight := f.trees[i][x]
-		bottomScore++
-		if currHeight >= treeHeight {
-			break
+	return watchers
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func parseCoord(s string) (coord, error) {
+	var c coord
+	if _, err := fmt.Sscanf(s, "%d,%d", &c.x, &c.y); err != nil {
+		return c, fmt.Errorf("invalid position %q, expected x,y", s)
+	}
+	return c, nil
+}
+
+// parseDirections reads "4" for the axis directions, "8" to add the
+// diagonals, or a semicolon-separated list of dx,dy direction vectors.
+func parseDirections(s string) ([]coord, error) {
+	switch s {
+	case "4":
+		return axisDirections, nil
+	case "8":
+		return allDirections, nil
+	}
+
+	dirs := []coord{}
+	for _, field := range strings.Split(s, ";") {
+		dir, err := parseCoord(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid direction %q, expected dx,dy", field)
 		}
+		if dir == (coord{}) {
+			return nil, errors.New("direction 0,0 does not point anywhere")
+		}
+		dirs = append(dirs, dir)
 	}
+	return dirs, nil
+}
 
-	return leftScore * rightScore * topScore * bottomScore
+func (f treeFarm) describeTrees(trees []coord) string {
+	desc := make([]string, len(trees))
+	for i, c := range trees {
+		desc[i] = fmt.Sprintf("(%d,%d) height %d", c.x, c.y, f.trees[c.y][c.x])
+	}
+	return strings.Join(desc, "\n")
 }
 
 func newTreeFarm() *treeFarm {
@@ -146,7 +465,197 @@ func newTreeFarm() *treeFarm {
 	}
 }
 
+// renderVisibility draws the farm as a grid where visible trees are marked
+// with '#', hidden trees with '.' and the most scenic tree with '*'.
+func (f treeFarm) renderVisibility() string {
+	visible, scores := f.surveyVisibility(), f.surveyScenicScores()
+
+	best, bestScore := coord{}, -1
+	for y, row := range scores {
+		for x, score := range row {
+			if score > bestScore {
+				best, bestScore = coord{x: x, y: y}, score
+			}
+		}
+	}
+
+	grid := strings.Builder{}
+	grid.Grow(f.height() * (f.width() + 1))
+
+	for y, row := range f.trees {
+		for x := range row {
+			switch {
+			case best == coord{x: x, y: y}:
+				grid.WriteByte('*')
+			case visible.has(x, y):
+				grid.WriteByte('#')
+			default:
+				grid.WriteByte('.')
+			}
+		}
+		grid.WriteByte('\n')
+	}
+
+	return grid.String()
+}
+
+// heatColor maps a value from 0 to 1 onto a black, red, yellow and white
+// colour scale.
+func heatColor(value float64) color.RGBA {
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(255 * math.Max(0, math.Min(1, v))))
+	}
+
+	return color.RGBA{
+		R: channel(value * 3),
+		G: channel(value*3 - 1),
+		B: channel(value*3 - 2),
+		A: 255,
+	}
+}
+
+// scenicHeatmap draws every tree's scenic score as a square of scale by scale
+// pixels. Scores span several orders of magnitude, so they are coloured on a
+// log scale.
+func (f treeFarm) scenicHeatmap(scale int) *image.RGBA {
+	scores := f.surveyScenicScores()
+
+	highest := 0
+	for _, row := range scores {
+		for _, score := range row {
+			highest = max(highest, score)
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, f.width()*scale, f.height()*scale))
+	for y, row := range scores {
+		for x, score := range row {
+			value := 0.0
+			if highest > 0 {
+				value = math.Log1p(float64(score)) / math.Log1p(float64(highest))
+			}
+
+			c := heatColor(value)
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetRGBA(x*scale+dx, y*scale+dy, c)
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+func writePPM(w io.Writer, img *image.RGBA) error {
+	bounds := img.Bounds()
+	buf := bufio.NewWriter(w)
+
+	fmt.Fprintf(buf, "P6\n%d %d\n255\n", bounds.Dx(), bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			buf.Write([]byte{c.R, c.G, c.B})
+		}
+	}
+
+	return buf.Flush()
+}
+
+func (f treeFarm) writeScenicCSV(w io.Writer) error {
+	scores := f.surveyScenicScores()
+
+	writer := csv.NewWriter(w)
+	record := make([]string, f.width())
+	for _, row := range scores {
+		for x, score := range row {
+			record[x] = strconv.Itoa(score)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeOutput creates the named file and writes to it, or writes to stdout
+// if the name is "-".
+func writeOutput(name string, write func(w io.Writer) error) error {
+	if name == "-" {
+		return write(os.Stdout)
+	}
+
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = write(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func exportHeatmap(farm *treeFarm, name string, scale int) error {
+	if scale < 1 {
+		return fmt.Errorf("invalid heatmap scale %d", scale)
+	}
+
+	img := farm.scenicHeatmap(scale)
+	return writeOutput(name, func(w io.Writer) error {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".ppm":
+			return writePPM(w, img)
+		case ".png":
+			return png.Encode(w, img)
+		default:
+			return fmt.Errorf("%s: heatmap must be a .png or .ppm file", name)
+		}
+	})
+}
+
 func main() {
+	render := flag.Bool(
+		"render",
+		false,
+		"draw the farm marking visible (#), hidden (.) and the most scenic (*) trees",
+	)
+	heatmapFile := flag.String(
+		"heatmap",
+		"",
+		"write a heatmap of scenic scores to a .png or .ppm `file`",
+	)
+	heatmapScale := flag.Int("scale", 4, "pixels per tree in the heatmap")
+	csvFile := flag.String(
+		"csv",
+		"",
+		"write the scenic scores as CSV to `file`, or - for stdout",
+	)
+	observer := flag.String(
+		"from",
+		"",
+		"list the trees an observer at `x,y` can see",
+	)
+	eyeHeight := flag.Int(
+		"eye",
+		-1,
+		"observer's eye height, defaulting to the height of the tree at -from",
+	)
+	target := flag.String(
+		"seen-by",
+		"",
+		"list the trees that can see the tree at `x,y`",
+	)
+	directions := flag.String(
+		"dirs",
+		"8",
+		"directions to look in: 4, 8 or a list of dx,dy vectors split by ;",
+	)
+	flag.Parse()
+
 	file, err := os.Open("input.txt")
 	if err != nil {
 		log.Println(err)
@@ -154,11 +663,87 @@ func main() {
 	}
 
 	farm := newTreeFarm()
-	farm.parseTrees(file)
+	err = farm.parseTrees(file)
+	file.Close()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	if *observer != "" || *target != "" {
+		if err := lineOfSight(farm, *observer, *eyeHeight, *target, *directions); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *render || *heatmapFile != "" || *csvFile != "" {
+		if *render {
+			fmt.Print(farm.renderVisibility())
+		}
+		if *heatmapFile != "" {
+			err = exportHeatmap(farm, *heatmapFile, *heatmapScale)
+		}
+		if err == nil && *csvFile != "" {
+			err = writeOutput(*csvFile, farm.writeScenicCSV)
+		}
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	visible := farm.findVisibleTrees()
-	log.Println(farm.getTreeScenicScore(0, 0, farm.trees[0][0]))
 	mostScenic := farm.findMostScenicScore()
 
 	log.Println("The total number of visible trees is:", visible)
 	log.Println("The highest scenic score of the farm is:", mostScenic)
 }
+
+func lineOfSight(farm *treeFarm, observer string, eye int, target, directions string) error {
+	dirs, err := parseDirections(directions)
+	if err != nil {
+		return err
+	}
+
+	if observer != "" {
+		from, err := parseCoord(observer)
+		if err != nil {
+			return err
+		}
+		if eye < 0 {
+			if !farm.inFarm(from) {
+				return errors.New("-eye is needed for an observer outside the farm")
+			}
+			eye = farm.trees[from.y][from.x]
+		}
+
+		visible := farm.lineOfSight(from, eye, dirs)
+		fmt.Printf(
+			"An observer at (%d,%d) with eye height %d can see %d trees:\n",
+			from.x, from.y, eye, len(visible),
+		)
+		fmt.Println(farm.describeTrees(visible))
+	}
+
+	if target != "" {
+		at, err := parseCoord(target)
+		if err != nil {
+			return err
+		}
+		if !farm.inFarm(at) {
+			return fmt.Errorf("(%d,%d) is outside the farm", at.x, at.y)
+		}
+
+		watchers := farm.seenBy(at, dirs)
+		fmt.Printf(
+			"The tree at (%d,%d) can be seen by %d trees:\n",
+			at.x, at.y, len(watchers),
+		)
+		fmt.Println(farm.describeTrees(watchers))
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+const (
+	randomForest  = "random"
+	pyramidForest = "pyramid"
+)
+
+// generateTreeFarm creates a square forest. Random forests use single-digit
+// heights, while pyramid forests grow taller towards the middle
+// so that every tree can see all the way to the edge in some direction, the
+// worst case for walking out from every tree.
+func generateTreeFarm(kind string, size int, rng *rand.Rand) (*treeFarm, error) {
+	farm := newTreeFarm()
+	for y := 0; y < size; y++ {
+		row := make([]int, size)
+		for x := range row {
+			switch kind {
+			case randomForest:
+				row[x] = rng.Intn(10)
+			case pyramidForest:
+				row[x] = min(x, y, size-1-x, size-1-y)
+			default:
+				return nil, fmt.Errorf("unknown forest kind %q", kind)
+			}
+		}
+		farm.trees = append(farm.trees, row)
+	}
+	return farm, nil
+}
+
+// findVisibleTreesNaive is the original visibility search, which rescans the
+// farm once for every possible height. It is kept as a baseline for the
+// benchmarks.
+func (f treeFarm) findVisibleTreesNaive() int {
+	visible := make(map[coord]bool)
+	lowest, highest := f.heightRange()
+
+	for h := lowest; h <= highest; h++ {
+		for i, row := range f.trees {
+			for j, height := range row {
+				if height == h {
+					visible[coord{x: j, y: i}] = true
+				}
+				if height >= h {
+					break
+				}
+			}
+			for j := len(row) - 1; j >= 0; j-- {
+				height := row[j]
+				if height == h {
+					visible[coord{x: j, y: i}] = true
+				}
+				if height >= h {
+					break
+				}
+			}
+		}
+		for i := 0; i < len(f.trees[0]); i++ {
+			for j := 0; j < len(f.trees); j++ {
+				height := f.trees[j][i]
+				if height == h {
+					visible[coord{x: i, y: j}] = true
+				}
+				if height >= h {
+					break
+				}
+			}
+			for j := len(f.trees) - 1; j >= 0; j-- {
+				height := f.trees[j][i]
+				if height == h {
+					visible[coord{x: i, y: j}] = true
+				}
+				if height >= h {
+					break
+				}
+			}
+		}
+	}
+
+	return len(visible)
+}
+
+// findMostScenicScoreNaive is the original scenic score search, which walks
+// out from every tree in all four directions. It is kept as a baseline for
+// the benchmarks.
+func (f treeFarm) findMostScenicScoreNaive() int {
+	max := 0
+
+	for i, row := range f.trees {
+		for j, height := range row {
+			score := f.getTreeScenicScore(j, i, height)
+			if score > max {
+				max = score
+			}
+		}
+	}
+
+	return max
+}
+
+func (f treeFarm) getTreeScenicScore(x, y, treeHeight int) int {
+	score := 1
+	for _, dir := range axisDirections {
+		score *= f.lookAlong(coord{x: x, y: y}, dir, treeHeight, nil)
+	}
+	return score
+}
+
+// benchForests are the forests every search is benchmarked on. The pyramid
+// forest is the worst case for the naive searches, which take cubic time on
+// it, so it is kept smaller.
+var benchForests = []struct {
+	kind string
+	size int
+}{
+	{randomForest, 5000},
+	{pyramidForest, 500},
+}
+
+// benchmarkForests runs a naive and a surveying search over every
+// benchmark forest, checking that they agree first.
+func benchmarkForests(b *testing.B, naive, survey func(f *treeFarm) int) {
+	for _, forest := range benchForests {
+		farm, err := generateTreeFarm(
+			forest.kind,
+			forest.size,
+			rand.New(rand.NewSource(1)),
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if got, want := survey(farm), naive(farm); got != want {
+			b.Fatalf("%s forest: survey found %d, naive found %d", forest.kind, got, want)
+		}
+
+		name := fmt.Sprintf("%s-%d", forest.kind, forest.size)
+		b.Run(name+"/naive", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				naive(farm)
+			}
+		})
+		b.Run(name+"/survey", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				survey(farm)
+			}
+		})
+	}
+}
+
+func BenchmarkVisibleTrees(b *testing.B) {
+	benchmarkForests(
+		b,
+		(*treeFarm).findVisibleTreesNaive,
+		(*treeFarm).findVisibleTrees,
+	)
+}
+
+func BenchmarkMostScenicScore(b *testing.B) {
+	benchmarkForests(
+		b,
+		(*treeFarm).findMostScenicScoreNaive,
+		(*treeFarm).findMostScenicScore,
+	)
+}
@@ -2,24 +2,71 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"log"
 	"math"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const ropeKnotsCount = 10
 
-type moveDirection byte
+type moveDirection string
 
 const (
-	leftDirection  moveDirection = 'L'
-	rightDirection moveDirection = 'R'
-	upDirection    moveDirection = 'U'
-	downDirection  moveDirection = 'D'
+	leftDirection  moveDirection = "L"
+	rightDirection moveDirection = "R"
+	upDirection    moveDirection = "U"
+	downDirection  moveDirection = "D"
 )
 
+// delta returns how far a single step moves a knot. Directions combine up
+// to one vertical and one horizontal letter, so "UL" and "DR" move
+// diagonally.
+func (d moveDirection) delta() (coord, error) {
+	var delta, seen coord
+
+	for _, c := range d {
+		switch moveDirection(c) {
+		case leftDirection:
+			delta.x--
+			seen.x++
+		case rightDirection:
+			delta.x++
+			seen.x++
+		case upDirection:
+			delta.y++
+			seen.y++
+		case downDirection:
+			delta.y--
+			seen.y++
+		default:
+			return coord{}, fmt.Errorf("unknown direction %q", string(d))
+		}
+	}
+
+	if seen.x > 1 || seen.y > 1 || delta == (coord{}) {
+		return coord{}, fmt.Errorf("unknown direction %q", string(d))
+	}
+
+	return delta, nil
+}
+
 type coord struct {
 	x, y int
 }
@@ -48,31 +95,121 @@ func (k *knot) moveBy(posDiff coord) {
 	k.moveTo(newPos)
 }
 
-func (k *knot) moveDirection(dir moveDirection) {
-	newPos := k.position
+func (k *knot) moveDirection(dir moveDirection) error {
+	delta, err := dir.delta()
+	if err != nil {
+		return err
+	}
 
-	switch dir {
-	case leftDirection:
-		newPos.x--
-	case rightDirection:
-		newPos.x++
-	case upDirection:
-		newPos.y++
-	case downDirection:
-		newPos.y--
-	default:
-		panic("unable to determine direction")
+	k.moveBy(delta)
+	return nil
+}
+
+// followRule decides whether a knot is still close enough to the knot ahead
+// of it, given how far apart they are, and which way a knot that has fallen
+// behind steps to catch up. Rules are looked up by name, so new ones only
+// need adding to getFollowRule.
+type followRule interface {
+	name() string
+	isAdjacent(diff coord) bool
+	follow(diff coord) coord
+}
+
+// followDiagonally steps one place towards the knot ahead along both axes.
+func followDiagonally(diff coord) coord {
+	return coord{x: sign(diff.x), y: sign(diff.y)}
+}
+
+// chebyshevRule keeps knots touching, diagonals included.
+type chebyshevRule struct{}
+
+func (chebyshevRule) name() string {
+	return "chebyshev"
+}
+
+func (chebyshevRule) isAdjacent(diff coord) bool {
+	return abs(diff.x) <= 1 && abs(diff.y) <= 1
+}
+
+func (chebyshevRule) follow(diff coord) coord {
+	return followDiagonally(diff)
+}
+
+// manhattanRule keeps knots touching along an axis only.
+type manhattanRule struct{}
+
+func (manhattanRule) name() string {
+	return "manhattan"
+}
+
+func (manhattanRule) isAdjacent(diff coord) bool {
+	return abs(diff.x)+abs(diff.y) <= 1
+}
+
+// follow steps along whichever axis the knot ahead is furthest away on,
+// preferring to move horizontally when it is as far away on both.
+func (manhattanRule) follow(diff coord) coord {
+	if abs(diff.x) >= abs(diff.y) {
+		return coord{x: sign(diff.x)}
 	}
+	return coord{y: sign(diff.y)}
+}
 
-	k.moveTo(newPos)
+// stretchRule lets knots drift up to maxStretch places apart in any
+// direction before following.
+type stretchRule struct {
+	maxStretch int
+}
+
+func (r stretchRule) name() string {
+	return fmt.Sprintf("stretch-%d", r.maxStretch)
+}
+
+func (r stretchRule) isAdjacent(diff coord) bool {
+	return abs(diff.x) <= r.maxStretch && abs(diff.y) <= r.maxStretch
+}
+
+func (stretchRule) follow(diff coord) coord {
+	return followDiagonally(diff)
+}
+
+// getFollowRule looks up a follow rule by name. Stretch rules are created
+// from names of the form "stretch-K".
+func getFollowRule(name string) (followRule, error) {
+	switch name {
+	case chebyshevRule{}.name():
+		return chebyshevRule{}, nil
+	case manhattanRule{}.name():
+		return manhattanRule{}, nil
+	}
+
+	var maxStretch int
+	if _, err := fmt.Sscanf(name, "stretch-%d", &maxStretch); err == nil {
+		if maxStretch < 1 {
+			return nil, fmt.Errorf("invalid maximum stretch %d", maxStretch)
+		}
+		return stretchRule{maxStretch: maxStretch}, nil
+	}
+
+	return nil, fmt.Errorf("unknown follow rule %q", name)
 }
 
-func (k knot) isAdjacent(comp knot) bool {
-	diff := k.position.diff(comp.position)
-	diff.x = int(math.Abs(float64(diff.x)))
-	diff.y = int(math.Abs(float64(diff.y)))
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
 
-	return diff.x <= 1 && diff.y <= 1
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	default:
+		return 0
+	}
 }
 
 func newKnot() *knot {
@@ -85,6 +222,14 @@ func newKnot() *knot {
 
 type bridgeRope []*knot
 
+func newBridgeRope(knots int) bridgeRope {
+	rope := make(bridgeRope, knots)
+	for i := range rope {
+		rope[i] = newKnot()
+	}
+	return rope
+}
+
 func (r bridgeRope) head() *knot {
 	return r[0]
 }
@@ -98,135 +243,857 @@ func (r bridgeRope) last() *knot {
 }
 
 func (r bridgeRope) String() string {
-	var grid string
 	minCoord := r.head().position
-	maxCoord := r.last().position
+	maxCoord := r.head().position
 
 	for _, knot := range r {
-		if knot.position.x < minCoord.x {
-			minCoord.x = knot.position.x
+		minCoord.x = min(minCoord.x, knot.position.x)
+		maxCoord.x = max(maxCoord.x, knot.position.x)
+		minCoord.y = min(minCoord.y, knot.position.y)
+		maxCoord.y = max(maxCoord.y, knot.position.y)
+	}
+
+	canvas := newRopeCanvas(
+		coord{minCoord.x, maxCoord.y},
+		maxCoord.x-minCoord.x+1,
+		maxCoord.y-minCoord.y+1,
+	)
+	canvas.fill('+')
+	canvas.drawRope(r)
+
+	return canvas.String()
+}
+
+// knotLabel returns the single character used to draw the knot at index num.
+func knotLabel(num int) byte {
+	const labels = "H123456789abcdefghijklmnopqrstuvwxyz"
+	if num < len(labels) {
+		return labels[num]
+	}
+	return '*'
+}
+
+// ropeCanvas is a fixed-size character grid onto a region of the bridge,
+// drawn row by row from the top. Each row ends with a newline, so the cells
+// can be written out as they are.
+type ropeCanvas struct {
+	origin        coord // the top-left cell
+	width, height int
+	cells         []byte
+}
+
+func newRopeCanvas(origin coord, width, height int) *ropeCanvas {
+	return &ropeCanvas{
+		origin: origin,
+		width:  width,
+		height: height,
+		cells:  make([]byte, (width+1)*height),
+	}
+}
+
+func (c *ropeCanvas) fill(b byte) {
+	for i := range c.cells {
+		if (i+1)%(c.width+1) == 0 {
+			c.cells[i] = '\n'
+		} else {
+			c.cells[i] = b
+		}
+	}
+}
+
+// set draws b at pos, ignoring positions outside the canvas.
+func (c *ropeCanvas) set(pos coord, b byte) {
+	col := pos.x - c.origin.x
+	row := c.origin.y - pos.y
+	if col < 0 || col >= c.width || row < 0 || row >= c.height {
+		return
+	}
+	c.cells[row*(c.width+1)+col] = b
+}
+
+// drawRope draws every knot, with knots nearer the head drawn on top.
+func (c *ropeCanvas) drawRope(r bridgeRope) {
+	for num := len(r) - 1; num >= 0; num-- {
+		c.set(r[num].position, knotLabel(num))
+	}
+}
+
+func (c *ropeCanvas) String() string {
+	return string(c.cells)
+}
+
+type moveInstruction struct {
+	direction moveDirection
+	amount    int
+}
+
+func (i moveInstruction) execute(rope bridgeRope, rule followRule) error {
+	for m := 0; m < i.amount; m++ {
+		if err := i.step(rope, rule); err != nil {
+			return err
 		}
-		if knot.position.x > maxCoord.x {
-			maxCoord.x = knot.position.x
+	}
+
+	return nil
+}
+
+// step moves the head a single place and lets the rest of the rope follow.
+func (i moveInstruction) step(rope bridgeRope, rule followRule) error {
+	head := rope.head()
+	if err := head.moveDirection(i.direction); err != nil {
+		return err
+	}
+
+	leadingKnot := head
+	for num, tail := range rope.tail() {
+		diff := leadingKnot.position.diff(tail.position)
+		if rule.isAdjacent(diff) {
+			break
 		}
-		if knot.position.y < minCoord.y {
-			minCoord.y = knot.position.y
+
+		// A diagonal head move can leave a knot two steps behind under
+		// rules that only follow along one axis, so keep stepping until
+		// it has caught up.
+		for !rule.isAdjacent(diff) {
+			tail.moveBy(rule.follow(diff))
+			diff = leadingKnot.position.diff(tail.position)
 		}
-		if knot.position.y > maxCoord.y {
-			maxCoord.y = knot.position.y
+		if diff == (coord{}) {
+			return fmt.Errorf(
+				"%s rule moved knot %d onto knot %d",
+				rule.name(), num+1, num,
+			)
 		}
+
+		leadingKnot = tail
 	}
 
-	for i := maxCoord.y; i >= minCoord.y; i-- {
-		row := ""
-		for j := minCoord.x; j <= maxCoord.x; j++ {
-			var knotAtPosNum string
-			for num, knot := range r {
-				if knot.position.x == j && knot.position.y == i {
-					if num == 0 {
-						knotAtPosNum = "H"
-					} else {
-						knotAtPosNum = strconv.Itoa(num)
-					}
-					break
-				}
+	return nil
+}
+
+func parseMoveInstructions(r io.Reader) ([]moveInstruction, error) {
+	fileScanner := bufio.NewScanner(r)
+	fileScanner.Split(bufio.ScanLines)
+
+	instructions := make([]moveInstruction, 0)
+	for i := 1; fileScanner.Scan(); i++ {
+		line := fileScanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var inst moveInstruction
+		_, err := fmt.Sscanf(line, "%s %d", &inst.direction, &inst.amount)
+		if err != nil || inst.amount < 0 {
+			return nil, fmt.Errorf("line %d: invalid move %q", i, line)
+		}
+		if _, err := inst.direction.delta(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i, err)
+		}
+
+		instructions = append(instructions, inst)
+	}
+
+	return instructions, fileScanner.Err()
+}
+
+// simulate runs every instruction on a new rope of the given length.
+func simulate(
+	instructions []moveInstruction,
+	knots int,
+	rule followRule,
+) (bridgeRope, error) {
+	if knots < 1 {
+		return nil, fmt.Errorf("a rope needs at least one knot, got %d", knots)
+	}
+
+	rope := newBridgeRope(knots)
+	for n, inst := range instructions {
+		if err := inst.execute(rope, rule); err != nil {
+			return nil, fmt.Errorf("move %d: %w", n+1, err)
+		}
+	}
+
+	return rope, nil
+}
+
+// ropeTrajectories holds where every knot was after each step, indexed by
+// step and then knot. The first step is the rope's starting position.
+type ropeTrajectories [][]coord
+
+func recordTrajectories(
+	instructions []moveInstruction,
+	knots int,
+	rule followRule,
+) (ropeTrajectories, error) {
+	if knots < 1 {
+		return nil, fmt.Errorf("a rope needs at least one knot, got %d", knots)
+	}
+
+	rope := newBridgeRope(knots)
+	snapshot := func() []coord {
+		positions := make([]coord, len(rope))
+		for k, knot := range rope {
+			positions[k] = knot.position
+		}
+		return positions
+	}
+
+	trajectories := ropeTrajectories{snapshot()}
+	for n, inst := range instructions {
+		for m := 0; m < inst.amount; m++ {
+			if err := inst.step(rope, rule); err != nil {
+				return nil, fmt.Errorf("move %d: %w", n+1, err)
 			}
-			if knotAtPosNum != "" {
-				row += knotAtPosNum
-			} else {
-				row += "+"
+			trajectories = append(trajectories, snapshot())
+		}
+	}
+
+	return trajectories, nil
+}
+
+// writeCSV writes one row per knot per step.
+func (t ropeTrajectories) writeCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"step", "knot", "x", "y"})
+
+	for step, positions := range t {
+		for k, pos := range positions {
+			out.Write([]string{
+				strconv.Itoa(step),
+				strconv.Itoa(k),
+				strconv.Itoa(pos.x),
+				strconv.Itoa(pos.y),
+			})
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+type jsonTrajectory struct {
+	Knot      int      `json:"knot"`
+	Positions [][2]int `json:"positions"`
+}
+
+// writeJSON writes each knot's positions as a list of [x, y] pairs.
+func (t ropeTrajectories) writeJSON(w io.Writer) error {
+	var knots []jsonTrajectory
+	if len(t) > 0 {
+		knots = make([]jsonTrajectory, len(t[0]))
+	}
+
+	for k := range knots {
+		knots[k] = jsonTrajectory{Knot: k, Positions: make([][2]int, len(t))}
+		for step, positions := range t {
+			knots[k].Positions[step] = [2]int{positions[k].x, positions[k].y}
+		}
+	}
+
+	return json.NewEncoder(w).Encode(knots)
+}
+
+// visitHeatmap counts how many steps knots spent in each cell, so a cell
+// two knots sat in for three steps has a count of six.
+type visitHeatmap struct {
+	counts             map[coord]int
+	minCoord, maxCoord coord
+	highest            int
+}
+
+func (t ropeTrajectories) heatmap() visitHeatmap {
+	h := visitHeatmap{counts: make(map[coord]int)}
+	if len(t) > 0 && len(t[0]) > 0 {
+		h.minCoord = t[0][0]
+		h.maxCoord = t[0][0]
+	}
+
+	for _, positions := range t {
+		for _, pos := range positions {
+			h.counts[pos]++
+			h.highest = max(h.highest, h.counts[pos])
+			h.minCoord.x = min(h.minCoord.x, pos.x)
+			h.maxCoord.x = max(h.maxCoord.x, pos.x)
+			h.minCoord.y = min(h.minCoord.y, pos.y)
+			h.maxCoord.y = max(h.maxCoord.y, pos.y)
+		}
+	}
+
+	return h
+}
+
+func (h visitHeatmap) width() int {
+	return h.maxCoord.x - h.minCoord.x + 1
+}
+
+func (h visitHeatmap) height() int {
+	return h.maxCoord.y - h.minCoord.y + 1
+}
+
+// value scales a cell's count from 0 to 1. A few cells around the start
+// are visited far more than the rest, so counts are scaled logarithmically.
+func (h visitHeatmap) value(pos coord) float64 {
+	count := h.counts[pos]
+	if count == 0 || h.highest == 0 {
+		return 0
+	}
+	return math.Log1p(float64(count)) / math.Log1p(float64(h.highest))
+}
+
+// String draws the heatmap with characters getting denser as the count
+// rises, leaving unvisited cells blank.
+func (h visitHeatmap) String() string {
+	const ramp = ".:-=+*#%@"
+
+	var sb strings.Builder
+	sb.Grow((h.width() + 1) * h.height())
+
+	for y := h.maxCoord.y; y >= h.minCoord.y; y-- {
+		for x := h.minCoord.x; x <= h.maxCoord.x; x++ {
+			pos := coord{x, y}
+			if h.counts[pos] == 0 {
+				sb.WriteByte(' ')
+				continue
 			}
+
+			i := int(h.value(pos) * float64(len(ramp)-1))
+			sb.WriteByte(ramp[i])
 		}
-		grid += row + "\n"
+		sb.WriteByte('\n')
 	}
 
-	return grid
+	return sb.String()
 }
 
-type moveInstruction struct {
-	direction moveDirection
-	amount    int
+// heatColor maps a value from 0 to 1 onto a black, red, yellow and white
+// colour scale.
+func heatColor(value float64) color.RGBA {
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(255 * math.Max(0, math.Min(1, v))))
+	}
+
+	return color.RGBA{
+		R: channel(value * 3),
+		G: channel(value*3 - 1),
+		B: channel(value*3 - 2),
+		A: 255,
+	}
 }
 
-func (i moveInstruction) execute(rope bridgeRope) {
-	head := rope.head()
-	tails := rope.tail()
+// image draws every cell as a square of scale by scale pixels.
+func (h visitHeatmap) image(scale int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, h.width()*scale, h.height()*scale))
 
-	for m := 0; m < i.amount; m++ {
-		head.moveDirection(i.direction)
+	for y := h.maxCoord.y; y >= h.minCoord.y; y-- {
+		for x := h.minCoord.x; x <= h.maxCoord.x; x++ {
+			c := heatColor(h.value(coord{x, y}))
+			top := (h.maxCoord.y - y) * scale
+			left := (x - h.minCoord.x) * scale
 
-		leadingKnot := head
-		for _, tail := range tails {
-			if tail.isAdjacent(*leadingKnot) {
-				break
+			for py := top; py < top+scale; py++ {
+				for px := left; px < left+scale; px++ {
+					img.SetRGBA(px, py, c)
+				}
 			}
-			diff := leadingKnot.position.diff(tail.position)
-			move := coord{}
-			if diff.x > 0 {
-				move.x = 1
+		}
+	}
+
+	return img
+}
+
+func writeOutput(name string, write func(w io.Writer) error) error {
+	if name == "-" {
+		return write(os.Stdout)
+	}
+
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = write(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// exportTrajectories writes the trajectories as CSV or JSON depending on
+// the file extension. Standard output gets CSV.
+func exportTrajectories(t ropeTrajectories, name string) error {
+	return writeOutput(name, func(w io.Writer) error {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case "", ".csv":
+			return t.writeCSV(w)
+		case ".json":
+			return t.writeJSON(w)
+		default:
+			return fmt.Errorf("%s: trajectories must be a .csv or .json file", name)
+		}
+	})
+}
+
+// exportHeatmap writes the heatmap as a PNG image or, for any other file
+// and standard output, as text.
+func exportHeatmap(h visitHeatmap, name string, scale int) error {
+	if scale < 1 {
+		return fmt.Errorf("invalid heatmap scale %d", scale)
+	}
+
+	return writeOutput(name, func(w io.Writer) error {
+		if strings.ToLower(filepath.Ext(name)) == ".png" {
+			return png.Encode(w, h.image(scale))
+		}
+
+		_, err := io.WriteString(w, h.String())
+		return err
+	})
+}
+
+func runExports(
+	instructions []moveInstruction,
+	knots int,
+	rule followRule,
+	trajectoriesFile, heatmapFile string,
+	scale int,
+) error {
+	trajectories, err := recordTrajectories(instructions, knots, rule)
+	if err != nil {
+		return err
+	}
+
+	if trajectoriesFile != "" {
+		if err := exportTrajectories(trajectories, trajectoriesFile); err != nil {
+			return err
+		}
+	}
+
+	if heatmapFile != "" {
+		err := exportHeatmap(trajectories.heatmap(), heatmapFile, scale)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const (
+	clearScreen = "\033[H\033[2J"
+	cursorHome  = "\033[H"
+)
+
+// ropeView is a fixed-size window onto the bridge that scrolls to keep the
+// head at least margin cells away from its edges.
+type ropeView struct {
+	canvas *ropeCanvas
+	margin int
+}
+
+func newRopeView(width, height int) *ropeView {
+	return &ropeView{
+		canvas: newRopeCanvas(coord{-width / 2, height / 2}, width, height),
+		margin: min(width, height) / 4,
+	}
+}
+
+// follow scrolls the view as little as possible to keep pos inside the
+// margin.
+func (v *ropeView) follow(pos coord) {
+	c := v.canvas
+
+	left := c.origin.x + v.margin
+	right := c.origin.x + c.width - 1 - v.margin
+	if pos.x < left {
+		c.origin.x -= left - pos.x
+	} else if pos.x > right {
+		c.origin.x += pos.x - right
+	}
+
+	top := c.origin.y - v.margin
+	bottom := c.origin.y - c.height + 1 + v.margin
+	if pos.y > top {
+		c.origin.y += pos.y - top
+	} else if pos.y < bottom {
+		c.origin.y -= bottom - pos.y
+	}
+}
+
+// draw redraws the canvas with the rope over the cells its tail has
+// visited. Only the cells inside the view are looked up, so drawing costs
+// the same however long the tail's trail gets.
+func (v *ropeView) draw(rope bridgeRope) {
+	c := v.canvas
+	c.fill('.')
+
+	visited := rope.last().visited
+	for row := 0; row < c.height; row++ {
+		for col := 0; col < c.width; col++ {
+			pos := coord{c.origin.x + col, c.origin.y - row}
+			if visited[pos] {
+				c.cells[row*(c.width+1)+col] = '#'
 			}
-			if diff.x < 0 {
-				move.x = -1
+		}
+	}
+
+	c.set(coord{0, 0}, 's')
+	c.drawRope(rope)
+}
+
+// ropePlayer steps through the instructions one head move at a time.
+type ropePlayer struct {
+	rope         bridgeRope
+	rule         followRule
+	instructions []moveInstruction
+	move, step   int // the next instruction, and the steps taken through it
+	view         *ropeView
+	frame        bytes.Buffer
+}
+
+func newRopePlayer(
+	instructions []moveInstruction,
+	knots int,
+	rule followRule,
+	width, height int,
+) *ropePlayer {
+	return &ropePlayer{
+		rope:         newBridgeRope(knots),
+		rule:         rule,
+		instructions: instructions,
+		view:         newRopeView(width, height),
+	}
+}
+
+func (p *ropePlayer) done() bool {
+	return p.move >= len(p.instructions)
+}
+
+// advance takes a single step, moving on to the next instruction once the
+// current one is complete.
+func (p *ropePlayer) advance() error {
+	for !p.done() && p.step >= p.instructions[p.move].amount {
+		p.move++
+		p.step = 0
+	}
+	if p.done() {
+		return nil
+	}
+
+	if err := p.instructions[p.move].step(p.rope, p.rule); err != nil {
+		return fmt.Errorf("move %d: %w", p.move+1, err)
+	}
+	p.step++
+	return nil
+}
+
+// render returns the current frame. The buffer it is built in is reused
+// between frames, so the result is only valid until the next call.
+func (p *ropePlayer) render(fps int, paused bool) []byte {
+	p.view.follow(p.rope.head().position)
+	p.view.draw(p.rope)
+
+	p.frame.Reset()
+	p.frame.WriteString(cursorHome)
+
+	if p.done() {
+		fmt.Fprintf(&p.frame, "Finished %d moves", len(p.instructions))
+	} else {
+		inst := p.instructions[p.move]
+		fmt.Fprintf(
+			&p.frame,
+			"Move %d/%d (%s %d), step %d",
+			p.move+1, len(p.instructions), inst.direction, inst.amount, p.step,
+		)
+	}
+	fmt.Fprintf(
+		&p.frame,
+		" | tail visited %d | %d fps",
+		len(p.rope.last().visited), fps,
+	)
+	if paused {
+		p.frame.WriteString(" | paused")
+	}
+	p.frame.WriteString("\033[K\n")
+	p.frame.Write(p.view.canvas.cells)
+	p.frame.WriteString(
+		"space: pause, n: step, +/-: speed, q: quit\033[K\n",
+	)
+
+	return p.frame.Bytes()
+}
+
+// readKeys sends every byte read from r, closing the channel once r is
+// exhausted.
+func readKeys(r io.Reader) <-chan byte {
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+
+		reader := bufio.NewReader(r)
+		for {
+			key, err := reader.ReadByte()
+			if err != nil {
+				return
 			}
-			if diff.y > 0 {
-				move.y = 1
+			keys <- key
+		}
+	}()
+	return keys
+}
+
+// setRawInput stops the terminal waiting for a newline before passing on
+// key presses, returning a function that restores it. The terminal is also
+// restored if the program is interrupted or terminated before then. Without
+// a terminal keys are still read, just a line at a time.
+func setRawInput() (restore func()) {
+	stty := func(args ...string) error {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+
+	if err := stty("cbreak", "-echo"); err != nil {
+		return func() {}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	var once sync.Once
+	restore = func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+			stty("-cbreak", "echo")
+		})
+	}
+
+	go func() {
+		select {
+		case <-signals:
+			restore()
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+
+	return restore
+}
+
+func playRope(player *ropePlayer, fps int, keys <-chan byte) error {
+	if fps < 1 {
+		return fmt.Errorf("invalid frame rate %d", fps)
+	}
+
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+
+	os.Stdout.WriteString(clearScreen)
+
+	paused := false
+	for {
+		if _, err := os.Stdout.Write(player.render(fps, paused)); err != nil {
+			return err
+		}
+		if player.done() {
+			return nil
+		}
+
+		var err error
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				keys = nil
+				paused = false
+				continue
+			}
+
+			switch key {
+			case ' ', 'p':
+				paused = !paused
+			case 'n', '.':
+				paused = true
+				err = player.advance()
+			case '+', '=':
+				fps = min(fps*2, 1000)
+				ticker.Reset(time.Second / time.Duration(fps))
+			case '-', '_':
+				fps = max(fps/2, 1)
+				ticker.Reset(time.Second / time.Duration(fps))
+			case 'q':
+				return nil
 			}
-			if diff.y < 0 {
-				move.y = -1
+		case <-ticker.C:
+			if !paused {
+				err = player.advance()
 			}
+		}
 
-			tail.moveBy(move)
-			leadingKnot = tail
+		if err != nil {
+			return err
 		}
 	}
 }
 
 func main() {
+	knots := flag.Int(
+		"knots",
+		0,
+		"simulate a single rope with this many knots instead of parts 1 and 2",
+	)
+	watched := flag.Int(
+		"knot",
+		-1,
+		"report the positions visited by this knot, 0 being the head "+
+			"(default the last knot); without -knots the ten-knot rope is used",
+	)
+	ruleName := flag.String(
+		"follow",
+		chebyshevRule{}.name(),
+		"how knots follow: chebyshev, manhattan or stretch-K",
+	)
+	play := flag.Bool("play", false, "animate the rope in the terminal")
+	fps := flag.Int("fps", 30, "frames per second when playing")
+	viewSize := flag.String(
+		"view",
+		"80x24",
+		"size of the playback viewport as `WxH`",
+	)
+	trajectoriesFile := flag.String(
+		"trajectories",
+		"",
+		"write every knot's position after each step to `file` (.csv or .json)",
+	)
+	heatmapFile := flag.String(
+		"heatmap",
+		"",
+		"write a heatmap of the cells knots visited to `file` (.png or text)",
+	)
+	scale := flag.Int("scale", 4, "pixels per cell in PNG heatmaps")
+	flag.Parse()
+
+	rule, err := getFollowRule(*ruleName)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
 	file, err := os.Open("input.txt")
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
 
-	fileScanner := bufio.NewScanner(file)
-	fileScanner.Split(bufio.ScanLines)
+	instructions, err := parseMoveInstructions(file)
+	file.Close()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
 
-	instructions := make([]moveInstruction, 0)
-	for fileScanner.Scan() {
-		line := fileScanner.Text()
-		var inst moveInstruction
-		fmt.Sscanf(line, "%c %d", &inst.direction, &inst.amount)
+	if *play {
+		var width, height int
+		_, err := fmt.Sscanf(*viewSize, "%dx%d", &width, &height)
+		if err != nil || width < 1 || height < 1 {
+			log.Printf("invalid viewport size %q\n", *viewSize)
+			os.Exit(1)
+		}
 
-		instructions = append(instructions, inst)
+		if *knots < 1 {
+			*knots = ropeKnotsCount
+		}
+
+		restore := setRawInput()
+		player := newRopePlayer(instructions, *knots, rule, width, height)
+		err = playRope(player, *fps, readKeys(os.Stdin))
+		restore()
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *trajectoriesFile != "" || *heatmapFile != "" {
+		if *knots < 1 {
+			*knots = ropeKnotsCount
+		}
+
+		err := runExports(
+			instructions,
+			*knots,
+			rule,
+			*trajectoriesFile,
+			*heatmapFile,
+			*scale,
+		)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *watched >= 0 && *knots < 1 {
+		*knots = ropeKnotsCount
+	}
+
+	if *knots > 0 {
+		if err := runRope(instructions, *knots, *watched, rule); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	part1(instructions)
-	part2(instructions)
+	part1(instructions, rule)
+	part2(instructions, rule)
 }
 
-func part1(instructions []moveInstruction) {
-	head := newKnot()
-	tail := newKnot()
-	rope := bridgeRope{head, tail}
+func runRope(
+	instructions []moveInstruction,
+	knots, watched int,
+	rule followRule,
+) error {
+	if watched < 0 {
+		watched = knots - 1
+	}
+	if watched >= knots {
+		return fmt.Errorf("knot %d is not in a rope of %d knots", watched, knots)
+	}
 
-	for _, inst := range instructions {
-		inst.execute(rope)
+	rope, err := simulate(instructions, knots, rule)
+	if err != nil {
+		return err
 	}
 
 	log.Printf(
-		"The tail knot in the two-knot rope moved to %d different positions.\n",
-		len(tail.visited),
+		"Knot %d of the %d-knot rope moved to %d different positions.\n",
+		watched, knots, len(rope[watched].visited),
 	)
+	return nil
 }
 
-func part2(instructions []moveInstruction) {
-	rope := make(bridgeRope, ropeKnotsCount)
-	for i := range rope {
-		rope[i] = newKnot()
+func part1(instructions []moveInstruction, rule followRule) {
+	rope, err := simulate(instructions, 2, rule)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
 	}
 
-	for _, inst := range instructions {
-		inst.execute(rope)
+	log.Printf(
+		"The tail knot in the two-knot rope moved to %d different positions.\n",
+		len(rope.last().visited),
+	)
+}
+
+func part2(instructions []moveInstruction, rule followRule) {
+	rope, err := simulate(instructions, ropeKnotsCount, rule)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
 	}
 
 	tail := rope.last()
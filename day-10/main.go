@@ -2,71 +2,258 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 )
 
 const (
 	noopInstruction = "noop"
 	addxInstruction = "addx"
+	addyInstruction = "addy"
+	mulInstruction  = "mul"
+	jmpInstruction  = "jmp"
+
+	xRegister = "X"
+	yRegister = "Y"
 
 	crtWidth  = 40
 	crtHeight = 6
+
+	defaultCycleLimit = 1_000_000
 )
 
-type register struct {
-	value   int
-	history map[uint]int
+var errCycleLimit = errors.New("cycle limit reached")
+
+// opcode describes how an instruction runs. An instruction takes a fixed
+// number of cycles, and only changes the CPU's state once the last of them
+// is over, by which point the program counter already points at the next
+// instruction.
+type opcode struct {
+	cycles   int
+	operands int
+	execute  func(cpu *deviceCPU, args []int)
+}
+
+// instructionSet holds every instruction the CPU understands. New
+// instructions only need registering here; the CPU looks them up by name.
+var instructionSet = map[string]opcode{}
+
+func registerInstruction(name string, op opcode) {
+	if op.cycles < 1 {
+		panic(fmt.Sprintf("instruction %s must take at least one cycle", name))
+	}
+	instructionSet[name] = op
+}
+
+func init() {
+	registerInstruction(noopInstruction, opcode{
+		cycles:  1,
+		execute: func(*deviceCPU, []int) {},
+	})
+	registerInstruction(addxInstruction, opcode{
+		cycles:   2,
+		operands: 1,
+		execute: func(cpu *deviceCPU, args []int) {
+			cpu.registers[xRegister] += args[0]
+		},
+	})
+	registerInstruction(addyInstruction, opcode{
+		cycles:   2,
+		operands: 1,
+		execute: func(cpu *deviceCPU, args []int) {
+			cpu.registers[yRegister] += args[0]
+		},
+	})
+	registerInstruction(mulInstruction, opcode{
+		cycles:   4,
+		operands: 1,
+		execute: func(cpu *deviceCPU, args []int) {
+			cpu.registers[xRegister] *= args[0]
+		},
+	})
+	registerInstruction(jmpInstruction, opcode{
+		cycles:   2,
+		operands: 1,
+		execute: func(cpu *deviceCPU, args []int) {
+			cpu.pc += args[0] - 1
+		},
+	})
+}
+
+type instruction struct {
+	name string
+	args []int
 }
 
-func (r *register) addValue(val int, cycle uint) {
-	r.value += val
-	r.history[cycle] = r.value
+func (i instruction) String() string {
+	var sb strings.Builder
+	sb.WriteString(i.name)
+	for _, arg := range i.args {
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.Itoa(arg))
+	}
+	return sb.String()
+}
+
+func parseProgram(r io.Reader) ([]instruction, error) {
+	fileScanner := bufio.NewScanner(r)
+	fileScanner.Split(bufio.ScanLines)
+
+	program := make([]instruction, 0)
+	for n := 1; fileScanner.Scan(); n++ {
+		fields := strings.Fields(fileScanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		inst := instruction{name: fields[0]}
+		op, ok := instructionSet[inst.name]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown instruction %q", n, inst.name)
+		}
+		if len(fields)-1 != op.operands {
+			return nil, fmt.Errorf(
+				"line %d: %s takes %d operands, got %d",
+				n, inst.name, op.operands, len(fields)-1,
+			)
+		}
+
+		for _, field := range fields[1:] {
+			arg, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid operand %q", n, field)
+			}
+			inst.args = append(inst.args, arg)
+		}
+
+		program = append(program, inst)
+	}
+
+	return program, fileScanner.Err()
 }
 
+// cycleHook is called during every cycle, before any instruction finishing
+// in that cycle has changed the registers.
+type cycleHook func(cpu *deviceCPU)
+
 type deviceCPU struct {
-	cycle     uint
-	xRegister *register
+	program    []instruction
+	pc         int
+	cycle      int // the cycle currently running, starting from 1
+	elapsed    int // cycles already spent on the current instruction
+	registers  map[string]int
+	hooks      []cycleHook
+	cycleLimit int
+}
+
+func newDeviceCPU(program []instruction) *deviceCPU {
+	return &deviceCPU{
+		program:    program,
+		cycle:      1,
+		registers:  map[string]int{xRegister: 1, yRegister: 0},
+		cycleLimit: defaultCycleLimit,
+	}
+}
+
+func (c *deviceCPU) attach(hook cycleHook) {
+	c.hooks = append(c.hooks, hook)
+}
+
+func (c *deviceCPU) halted() bool {
+	return c.pc < 0 || c.pc >= len(c.program)
+}
+
+// current returns the instruction being run.
+func (c *deviceCPU) current() instruction {
+	return c.program[c.pc]
+}
+
+// stepCycle runs a single cycle, finishing the current instruction if this
+// was its last cycle.
+func (c *deviceCPU) stepCycle() error {
+	if c.halted() {
+		return nil
+	}
+	if c.cycle > c.cycleLimit {
+		return fmt.Errorf("%w after %d cycles", errCycleLimit, c.cycleLimit)
+	}
+
+	inst := c.current()
+	op := instructionSet[inst.name]
+
+	for _, hook := range c.hooks {
+		hook(c)
+	}
+
+	c.cycle++
+	c.elapsed++
+	if c.elapsed == op.cycles {
+		c.elapsed = 0
+		c.pc++
+		op.execute(c, inst.args)
+	}
+
+	return nil
 }
 
-func (c *deviceCPU) executeInstruction(inst instruction) {
-	switch inst.name {
-	case noopInstruction:
-		c.cycle++
-	case addxInstruction:
-		c.cycle += 2
-		c.xRegister.addValue(inst.value, c.cycle)
-	default:
-		panic("unknown instruction name")
+// run runs the program until it jumps or steps past its end.
+func (c *deviceCPU) run() error {
+	for !c.halted() {
+		if err := c.stepCycle(); err != nil {
+			return err
+		}
 	}
+
+	return nil
+}
+
+// signalMonitor sums the signal strength during every interval-th cycle,
+// starting from the first.
+type signalMonitor struct {
+	first, interval int
+	sum             int
 }
 
-func (c deviceCPU) getValueAtCycle(cycle uint) int {
-	val, ok := 0, false
-	for !ok && cycle > 0 {
-		val, ok = c.xRegister.history[cycle]
-		cycle--
+func (m *signalMonitor) onCycle(cpu *deviceCPU) {
+	if cpu.cycle >= m.first && (cpu.cycle-m.first)%m.interval == 0 {
+		m.sum += cpu.cycle * cpu.registers[xRegister]
 	}
+}
+
+// crtScreen draws a pixel every cycle, lighting it if the three pixel wide
+// sprite centred on the X register covers it.
+type crtScreen struct {
+	pixels [crtHeight][crtWidth]bool
+}
 
-	return val
+func (s *crtScreen) onCycle(cpu *deviceCPU) {
+	row, col, lit := crtPixel(cpu.cycle, cpu.registers[xRegister])
+	s.pixels[row][col] = lit
 }
 
-func (c deviceCPU) getSignalStrength(cycle uint) int {
-	return int(cycle) * c.getValueAtCycle(cycle)
+// crtPixel returns the pixel drawn during a cycle and whether the sprite at
+// spriteX lights it.
+func crtPixel(cycle, spriteX int) (row, col int, lit bool) {
+	pos := (cycle - 1) % (crtWidth * crtHeight)
+	row, col = pos/crtWidth, pos%crtWidth
+	return row, col, col >= spriteX-1 && col <= spriteX+1
 }
 
-func (c deviceCPU) renderImage() string {
+func (s *crtScreen) renderImage() string {
 	crt := strings.Builder{}
 	crt.Grow(crtHeight*crtWidth + crtHeight)
-	
-	for i := 0; i < crtHeight; i++ {
-		for j := 1; j <= crtWidth; j++ {
-			cycle := uint((i * crtWidth) + j)
-			spriteX := c.getValueAtCycle(cycle) + 1
 
-			if j >= spriteX-1 && j <= spriteX+1 {
+	for _, row := range s.pixels {
+		for _, lit := range row {
+			if lit {
 				crt.WriteByte('#')
 			} else {
 				crt.WriteByte('.')
@@ -78,58 +265,489 @@ func (c deviceCPU) renderImage() string {
 	return crt.String()
 }
 
-func newDeviceCPU() *deviceCPU {
-	return &deviceCPU{
-		cycle: 1,
-		xRegister: &register{
-			value: 1,
-			history: map[uint]int{
-				1: 1,
-			},
-		},
+// crtFont holds the bitmap of every letter the CRT is known to draw, with
+// the blank columns either side trimmed off. Most letters are four pixels
+// wide, but some are narrower or wider.
+var crtFont = map[rune][crtHeight]string{
+	'A': {".##.", "#..#", "#..#", "####", "#..#", "#..#"},
+	'B': {"###.", "#..#", "###.", "#..#", "#..#", "###."},
+	'C': {".##.", "#..#", "#...", "#...", "#..#", ".##."},
+	'E': {"####", "#...", "###.", "#...", "#...", "####"},
+	'F': {"####", "#...", "###.", "#...", "#...", "#..."},
+	'G': {".##.", "#..#", "#...", "#.##", "#..#", ".###"},
+	'H': {"#..#", "#..#", "####", "#..#", "#..#", "#..#"},
+	'I': {"###", ".#.", ".#.", ".#.", ".#.", "###"},
+	'J': {"..##", "...#", "...#", "...#", "#..#", ".##."},
+	'K': {"#..#", "#.#.", "##..", "#.#.", "#.#.", "#..#"},
+	'L': {"#...", "#...", "#...", "#...", "#...", "####"},
+	'O': {".##.", "#..#", "#..#", "#..#", "#..#", ".##."},
+	'P': {"###.", "#..#", "#..#", "###.", "#...", "#..."},
+	'R': {"###.", "#..#", "#..#", "###.", "#.#.", "#..#"},
+	'S': {".###", "#...", "#...", ".##.", "...#", "###."},
+	'U': {"#..#", "#..#", "#..#", "#..#", "#..#", ".##."},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#.."},
+	'Z': {"####", "...#", "..#.", ".#..", "#...", "####"},
+}
+
+// glyphLetters looks up letters by their bitmap, as drawn by glyph.String.
+var glyphLetters = map[string]rune{}
+
+func init() {
+	for letter, rows := range crtFont {
+		glyphLetters[strings.Join(rows[:], "\n")] = letter
 	}
 }
 
-type instruction struct {
-	name  string
-	value int
+// glyph is a single character cut out of the CRT image.
+type glyph [crtHeight]string
+
+func (g glyph) String() string {
+	return strings.Join(g[:], "\n")
+}
+
+type unknownGlyphError struct {
+	position int
+	bitmap   glyph
+}
+
+func (e unknownGlyphError) Error() string {
+	return fmt.Sprintf("unknown glyph at character %d:\n%v", e.position, e.bitmap)
+}
+
+// glyphs splits the image into characters wherever a column of pixels is
+// unlit.
+func (s *crtScreen) glyphs() []glyph {
+	blank := func(col int) bool {
+		for _, row := range s.pixels {
+			if row[col] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var glyphs []glyph
+	for col := 0; col < crtWidth; col++ {
+		if blank(col) {
+			continue
+		}
+
+		start := col
+		for col < crtWidth && !blank(col) {
+			col++
+		}
+
+		var g glyph
+		for y, row := range s.pixels {
+			var sb strings.Builder
+			for _, lit := range row[start:col] {
+				if lit {
+					sb.WriteByte('#')
+				} else {
+					sb.WriteByte('.')
+				}
+			}
+			g[y] = sb.String()
+		}
+		glyphs = append(glyphs, g)
+	}
+
+	return glyphs
+}
+
+// readText recognises the letters drawn on the CRT. Glyphs that aren't in
+// the font are read as '?' and reported in the returned error.
+func (s *crtScreen) readText() (string, error) {
+	var text strings.Builder
+	var errs []error
+
+	for i, g := range s.glyphs() {
+		letter, ok := glyphLetters[g.String()]
+		if !ok {
+			letter = '?'
+			errs = append(errs, unknownGlyphError{position: i + 1, bitmap: g})
+		}
+		text.WriteRune(letter)
+	}
+
+	return text.String(), errors.Join(errs...)
+}
+
+// breakpoint stops the debugger when a comparison between the cycle number
+// or a register and a constant becomes true.
+type breakpoint struct {
+	operand  string
+	operator string
+	value    int
+	held     bool // whether the comparison held after the last cycle
+}
+
+const cycleOperand = "cycle"
+
+var comparisons = map[string]func(a, b int) bool{
+	"==": func(a, b int) bool { return a == b },
+	"!=": func(a, b int) bool { return a != b },
+	"<":  func(a, b int) bool { return a < b },
+	"<=": func(a, b int) bool { return a <= b },
+	">":  func(a, b int) bool { return a > b },
+	">=": func(a, b int) bool { return a >= b },
+}
+
+// parseBreakpoint reads either a lone cycle number or a comparison such as
+// "X > 20" or "cycle >= 100".
+func parseBreakpoint(cpu *deviceCPU, args []string) (breakpoint, error) {
+	if len(args) == 1 {
+		args = []string{cycleOperand, "==", args[0]}
+	}
+	if len(args) != 3 {
+		return breakpoint{}, errors.New("expected a cycle or a comparison")
+	}
+
+	b := breakpoint{operand: args[0], operator: args[1]}
+	if _, ok := cpu.registers[b.operand]; !ok && b.operand != cycleOperand {
+		return breakpoint{}, fmt.Errorf("unknown register %q", b.operand)
+	}
+	if _, ok := comparisons[b.operator]; !ok {
+		return breakpoint{}, fmt.Errorf("unknown comparison %q", b.operator)
+	}
+
+	var err error
+	if b.value, err = strconv.Atoi(args[2]); err != nil {
+		return breakpoint{}, fmt.Errorf("invalid value %q", args[2])
+	}
+
+	b.held = b.holds(cpu)
+	return b, nil
+}
+
+func (b breakpoint) holds(cpu *deviceCPU) bool {
+	operand := cpu.cycle
+	if b.operand != cycleOperand {
+		operand = cpu.registers[b.operand]
+	}
+	return comparisons[b.operator](operand, b.value)
+}
+
+func (b breakpoint) String() string {
+	return fmt.Sprintf("%s %s %d", b.operand, b.operator, b.value)
+}
+
+// debugger runs a program a cycle at a time, drawing onto its own CRT.
+type debugger struct {
+	cpu         *deviceCPU
+	screen      *crtScreen
+	breakpoints []*breakpoint
+	out         io.Writer
+}
+
+func newDebugger(program []instruction, out io.Writer) *debugger {
+	d := &debugger{
+		cpu:    newDeviceCPU(program),
+		screen: &crtScreen{},
+		out:    out,
+	}
+	d.cpu.attach(d.screen.onCycle)
+	return d
+}
+
+// stepCycle runs a single cycle, returning the first breakpoint whose
+// comparison became true.
+func (d *debugger) stepCycle() (*breakpoint, error) {
+	if err := d.cpu.stepCycle(); err != nil {
+		return nil, err
+	}
+
+	var hit *breakpoint
+	for _, b := range d.breakpoints {
+		holds := b.holds(d.cpu)
+		if holds && !b.held && hit == nil {
+			hit = b
+		}
+		b.held = holds
+	}
+
+	return hit, nil
+}
+
+// stepInstruction runs until the current instruction has finished.
+func (d *debugger) stepInstruction() (*breakpoint, error) {
+	for !d.cpu.halted() {
+		hit, err := d.stepCycle()
+		if hit != nil || err != nil || d.cpu.elapsed == 0 {
+			return hit, err
+		}
+	}
+	return nil, nil
+}
+
+func (d *debugger) resume() (*breakpoint, error) {
+	for !d.cpu.halted() {
+		hit, err := d.stepCycle()
+		if hit != nil || err != nil {
+			return hit, err
+		}
+	}
+	return nil, nil
+}
+
+func (d *debugger) printState() {
+	cpu := d.cpu
+	if cpu.halted() {
+		fmt.Fprintf(d.out, "Program finished after %d cycles\n", cpu.cycle-1)
+		return
+	}
+
+	inst := cpu.current()
+	x := cpu.registers[xRegister]
+	row, col, lit := crtPixel(cpu.cycle, x)
+
+	fmt.Fprintf(
+		d.out,
+		"cycle %d, pc %d: %v (cycle %d of %d)\n",
+		cpu.cycle, cpu.pc, inst, cpu.elapsed+1, instructionSet[inst.name].cycles,
+	)
+	fmt.Fprintf(d.out, "  registers: %s\n", d.formatRegisters())
+	fmt.Fprintf(
+		d.out,
+		"  sprite: columns %d to %d, drawing row %d column %d %s\n",
+		x-1, x+1, row, col, pixelState(lit),
+	)
+}
+
+func (d *debugger) formatRegisters() string {
+	names := make([]string, 0, len(d.cpu.registers))
+	for name := range d.cpu.registers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = fmt.Sprintf("%s=%d", name, d.cpu.registers[name])
+	}
+	return strings.Join(fields, " ")
+}
+
+func pixelState(lit bool) string {
+	if lit {
+		return "lit"
+	}
+	return "dark"
+}
+
+func (d *debugger) run(input io.Reader) error {
+	d.printState()
+	fmt.Fprintln(
+		d.out,
+		"Commands: s(tep) [n], n(ext), c(ontinue), b(reak) [cycle | reg op n], "+
+			"d(elete) <n>, p(rint), crt, q(uit)",
+	)
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		var hit *breakpoint
+		var err error
+		switch args[0] {
+		case "s", "step":
+			cycles := 1
+			if len(args) > 1 {
+				cycles, err = strconv.Atoi(args[1])
+			}
+			for i := 0; i < cycles && err == nil && !d.cpu.halted(); i++ {
+				_, err = d.stepCycle()
+			}
+		case "n", "next":
+			hit, err = d.stepInstruction()
+		case "c", "continue":
+			hit, err = d.resume()
+		case "b", "break":
+			if len(args) == 1 {
+				d.listBreakpoints()
+				continue
+			}
+			var b breakpoint
+			if b, err = parseBreakpoint(d.cpu, args[1:]); err == nil {
+				d.breakpoints = append(d.breakpoints, &b)
+				fmt.Fprintf(d.out, "Breakpoint %d: %v\n", len(d.breakpoints), b)
+				continue
+			}
+		case "d", "delete":
+			err = d.deleteBreakpoint(args[1:])
+			if err == nil {
+				continue
+			}
+		case "p", "print":
+		case "crt":
+			fmt.Fprint(d.out, d.screen.renderImage())
+			continue
+		case "q", "quit":
+			return nil
+		default:
+			err = fmt.Errorf("unknown command %q", args[0])
+		}
+
+		if err != nil {
+			fmt.Fprintln(d.out, "error:", err)
+			continue
+		}
+		if hit != nil {
+			fmt.Fprintf(d.out, "Stopped at breakpoint: %v\n", hit)
+		}
+		d.printState()
+	}
+
+	return scanner.Err()
+}
+
+func (d *debugger) listBreakpoints() {
+	if len(d.breakpoints) == 0 {
+		fmt.Fprintln(d.out, "No breakpoints")
+	}
+	for i, b := range d.breakpoints {
+		fmt.Fprintf(d.out, "%d: %v\n", i+1, b)
+	}
+}
+
+func (d *debugger) deleteBreakpoint(args []string) error {
+	if len(args) != 1 {
+		return errors.New("delete needs a breakpoint number")
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(d.breakpoints) {
+		return fmt.Errorf("no breakpoint %q", args[0])
+	}
+
+	d.breakpoints = append(d.breakpoints[:n-1], d.breakpoints[n:]...)
+	return nil
+}
+
+// writeTrace runs the program, writing a row for every cycle with the X
+// register before and after the cycle and the pixel drawn during it.
+func writeTrace(program []instruction, w io.Writer) error {
+	cpu := newDeviceCPU(program)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "cycle\tinstruction\tX before\tX after\tpixel\t")
+
+	for !cpu.halted() {
+		cycle := cpu.cycle
+		inst := cpu.current()
+		before := cpu.registers[xRegister]
+		row, col, lit := crtPixel(cycle, before)
+
+		if err := cpu.stepCycle(); err != nil {
+			return err
+		}
+
+		pixel := '.'
+		if lit {
+			pixel = '#'
+		}
+		fmt.Fprintf(
+			tw,
+			"%d\t%v\t%d\t%d\t%c (%d,%d)\t\n",
+			cycle, inst, before, cpu.registers[xRegister], pixel, row, col,
+		)
+	}
+
+	return tw.Flush()
+}
+
+func writeOutput(name string, write func(w io.Writer) error) error {
+	if name == "-" {
+		return write(os.Stdout)
+	}
+
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = write(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 func main() {
+	debug := flag.Bool(
+		"debug",
+		false,
+		"step through the program with commands read from stdin",
+	)
+	trace := flag.String(
+		"trace",
+		"",
+		"write a table of every cycle to `file` (- for stdout)",
+	)
+	flag.Parse()
+
 	file, err := os.Open("input.txt")
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
 
-	fileScanner := bufio.NewScanner(file)
-	fileScanner.Split(bufio.ScanLines)
-
-	cpu := newDeviceCPU()
+	program, err := parseProgram(file)
+	file.Close()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
 
-	for fileScanner.Scan() {
-		line := fileScanner.Text()
-		var inst instruction
-		fmt.Sscanf(line, "%s %d", &inst.name, &inst.value)
+	if *debug {
+		if err := newDebugger(program, os.Stdout).run(os.Stdin); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 
-		cpu.executeInstruction(inst)
+	if *trace != "" {
+		err := writeOutput(*trace, func(w io.Writer) error {
+			return writeTrace(program, w)
+		})
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	part1(cpu)
-	part2(cpu)
-}
+	cpu := newDeviceCPU(program)
+	monitor := &signalMonitor{first: 20, interval: 40}
+	screen := &crtScreen{}
+	cpu.attach(monitor.onCycle)
+	cpu.attach(screen.onCycle)
 
-func part1(cpu *deviceCPU) {
-	signalStrengthSum := 0
-	for c := 20; uint(c) < cpu.cycle; c += 40 {
-		signalStrengthSum += cpu.getSignalStrength(uint(c))
+	if err := cpu.run(); err != nil {
+		log.Println(err)
+		os.Exit(1)
 	}
 
-	fmt.Println("Signal strength sum for cycles:", signalStrengthSum)
+	part1(monitor)
+	part2(screen)
+}
+
+func part1(monitor *signalMonitor) {
+	fmt.Println("Signal strength sum for cycles:", monitor.sum)
 }
 
-func part2(cpu *deviceCPU) {
-	crtImage := cpu.renderImage()
-	fmt.Println("The following is the image rendered onto the CRT:")
-	fmt.Print(crtImage)
+func part2(screen *crtScreen) {
+	text, err := screen.readText()
+	if err != nil {
+		log.Println(err)
+		fmt.Println("The following is the image rendered onto the CRT:")
+		fmt.Print(screen.renderImage())
+		os.Exit(1)
+	}
+
+	fmt.Println("The CRT displays:", text)
 }